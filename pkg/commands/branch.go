@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"github.com/puerco/vtrelease/pkg/release"
+	"github.com/spf13/cobra"
+)
+
+type BranchOptions struct {
+	MainBranch string
+}
+
+func AddBranch(parent *cobra.Command) {
+	opts := &BranchOptions{}
+	cmd := &cobra.Command{
+		Use:           "branch",
+		Short:         "Cut a new major release branch from main",
+		Long:          "Create the release-N.0 branch from main and bump main to the next major development version",
+		Example:       `  vtrelease branch --main-branch=main`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(*cobra.Command, []string) error {
+			return runBranch(opts)
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(
+		&opts.MainBranch,
+		"main-branch",
+		release.DefaultBranchOptions.MainBranch,
+		"development branch to cut the release branch from",
+	)
+
+	parent.AddCommand(cmd)
+}
+
+func runBranch(opts *BranchOptions) error {
+	o := release.DefaultBranchOptions
+	o.RepoPath = rootOpts.RepoPath
+	o.MainBranch = opts.MainBranch
+	o.NoMock = rootOpts.NoMock
+
+	return release.NewBranch(o).Run()
+}
@@ -2,15 +2,29 @@ package commands
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/puerco/vtrelease/pkg/release"
 	"github.com/spf13/cobra"
 )
 
 type BuildOptions struct {
-	Branch  string
-	Version string
+	Branch          string
+	Version         string
+	StagingRegistry string
+	Platforms       []string
+	Builder         string
+	ArtifactsDir    string
+	SigningKey      string
+	SourceRepo      string
+	StateFile       string
+}
+
+type ImagesOptions struct {
+	All  bool
+	Jobs int
 }
 
 func AddBuild(parent *cobra.Command) {
@@ -34,7 +48,7 @@ func AddBuild(parent *cobra.Command) {
 				return errors.New("you must soecify the name if the image to build")
 			}
 			if len(args) > 1 {
-				return errors.New("image should only process one image a a time ")
+				return errors.New("image only processes one image at a time, use images to build more")
 			}
 			return nil
 		},
@@ -43,36 +57,191 @@ func AddBuild(parent *cobra.Command) {
 		},
 	}
 
-	image.PersistentFlags().StringVar(
+	imagesOpts := &ImagesOptions{}
+	images := &cobra.Command{
+		Use:     "images --version=vM.m.p [--all | IMAGE_NAME...]",
+		Short:   "Build several vitess container images in dependency order",
+		Example: `  vtrelease build images --version=v12.0.4 --all --jobs=4`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if imagesOpts.All && len(args) > 0 {
+				return errors.New("image names cannot be specified with --all")
+			}
+			if !imagesOpts.All && len(args) == 0 {
+				return errors.New("you must specify the images to build or --all")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runImagesBuild(opts, imagesOpts, args)
+		},
+	}
+
+	binaries := &cobra.Command{
+		Use:     "binaries --version=vM.m.p",
+		Short:   "Build the vitess binary release tarballs",
+		Long:    "Compile the vitess binaries from the release tag for each platform and package them in tarballs with their checksums",
+		Example: `  vtrelease build binaries --version=v12.0.4 --platform=linux/amd64,linux/arm64`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBinariesBuild(opts)
+		},
+	}
+
+	packages := &cobra.Command{
+		Use:     "packages --version=vM.m.p",
+		Short:   "Build the vitess .deb and .rpm packages",
+		Long:    "Package the binaries built by \"build binaries\" in .deb and .rpm packages with their checksums",
+		Example: `  vtrelease build packages --version=v12.0.4 --platform=linux/amd64,linux/arm64`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPackagesBuild(opts)
+		},
+	}
+
+	images.PersistentFlags().BoolVar(
+		&imagesOpts.All,
+		"all",
+		false,
+		"build all the images found in the repository",
+	)
+
+	images.PersistentFlags().IntVar(
+		&imagesOpts.Jobs,
+		"jobs",
+		release.DefaultBuildOptions.Jobs,
+		"maximum number of images to build concurrently",
+	)
+
+	cmd.PersistentFlags().StringVar(
 		&opts.Version,
 		"version",
 		os.Getenv("VT_BASE_VER"),
 		"version tag to build",
 	)
 
-	image.PersistentFlags().StringVar(
-		&opts.Version,
+	cmd.PersistentFlags().StringVar(
+		&opts.StagingRegistry,
 		"staging-registry",
 		release.DefaultBuildOptions.StagingRegistry,
 		"registry where images are staged",
 	)
 
-	image.PersistentFlags().StringVarP(
+	cmd.PersistentFlags().StringSliceVar(
+		&opts.Platforms,
+		"platform",
+		release.DefaultBuildOptions.Platforms,
+		"platforms to build the images and binaries for, eg linux/amd64,linux/arm64",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&opts.Builder,
+		"builder",
+		release.DefaultBuildOptions.Builder,
+		fmt.Sprintf("container build backend, one of %s", strings.Join(release.Builders, ", ")),
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&opts.ArtifactsDir,
+		"artifacts-dir",
+		release.DefaultBuildOptions.ArtifactsDir,
+		"directory where the release artifacts are written",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&opts.SigningKey,
+		"signing-key",
+		"",
+		"PEM encoded private key to sign the provenance attestations, required to build images with --nomock",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&opts.SourceRepo,
+		"source-repository",
+		release.DefaultBuildOptions.SourceRepository,
+		"URL of the vitess repository recorded in the image provenance",
+	)
+
+	cmd.PersistentFlags().StringVarP(
 		&opts.Branch,
 		"branch",
 		"b",
 		"",
-		"branch to cut the release from. eg release-12",
+		"release branch that was staged, the version and release commit are read from its state. eg release-12.0",
 	)
 
-	cmd.AddCommand(image)
+	cmd.PersistentFlags().StringVar(
+		&opts.StateFile,
+		"state-file",
+		"",
+		"state file written by the stage (defaults to a file named after the branch in the temp dir)",
+	)
+
+	cmd.AddCommand(image, images, binaries, packages)
 	parent.AddCommand(cmd)
 }
 
-func runImageBuild(opts *BuildOptions, image string) error {
+func buildOptions(opts *BuildOptions) release.BuildOptions {
 	o := release.DefaultBuildOptions
 	o.VTBaseVersion = opts.Version
+	o.StagingRegistry = opts.StagingRegistry
+	o.Platforms = opts.Platforms
+	o.Builder = opts.Builder
+	o.ArtifactsDir = opts.ArtifactsDir
+	o.SigningKey = opts.SigningKey
+	o.SourceRepository = opts.SourceRepo
+	o.Branch = opts.Branch
+	o.StateFile = opts.StateFile
 	o.RepoPath = rootOpts.RepoPath
+	o.NoMock = rootOpts.NoMock
+	return o
+}
 
-	return release.NewBuild(o).Image(image)
+// newBuild returns a build with the stage state loaded, if any
+func newBuild(o release.BuildOptions) (*release.Build, error) {
+	build := release.NewBuild(o)
+	if err := build.LoadState(); err != nil {
+		return nil, err
+	}
+	return build, nil
+}
+
+func runImageBuild(opts *BuildOptions, image string) error {
+	build, err := newBuild(buildOptions(opts))
+	if err != nil {
+		return err
+	}
+	return build.Image(image)
+}
+
+func runImagesBuild(opts *BuildOptions, imagesOpts *ImagesOptions, images []string) error {
+	o := buildOptions(opts)
+	o.Jobs = imagesOpts.Jobs
+	build, err := newBuild(o)
+	if err != nil {
+		return err
+	}
+	if imagesOpts.All {
+		_, err := build.AllImages()
+		return err
+	}
+	_, err = build.Images(images)
+	return err
+}
+
+func runBinariesBuild(opts *BuildOptions) error {
+	build, err := newBuild(buildOptions(opts))
+	if err != nil {
+		return err
+	}
+	_, err = build.Binaries()
+	return err
+}
+
+func runPackagesBuild(opts *BuildOptions) error {
+	build, err := newBuild(buildOptions(opts))
+	if err != nil {
+		return err
+	}
+	_, err = build.Packages()
+	return err
 }
@@ -41,7 +41,7 @@ func New() *cobra.Command {
 		&rootOpts.NoMock,
 		"nomock",
 		false,
-		"⚠️ CAUTION",
+		"⚠️ CAUTION: run for real, modifying the repository and pushing artifacts. Without it, changes are only logged",
 	)
 
 	for _, f := range []string{"repo"} {
@@ -60,8 +60,19 @@ func New() *cobra.Command {
 func addCommands(cmd *cobra.Command) {
 	AddStage(cmd)
 	AddBuild(cmd)
+	AddRelease(cmd)
+	AddBranch(cmd)
+	AddPromote(cmd)
+	AddSign(cmd)
+	AddStampedVersion(cmd)
 }
 
 func initLogging(*cobra.Command, []string) error {
-	return log.SetupGlobalLogger(rootOpts.LogLevel)
+	if err := log.SetupGlobalLogger(rootOpts.LogLevel); err != nil {
+		return err
+	}
+	if !rootOpts.NoMock {
+		logrus.Warn("🧪 Running in mock mode, no changes will be made. Use --nomock to run for real")
+	}
+	return nil
 }
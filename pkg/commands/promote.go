@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"errors"
+	"os"
+
+	"github.com/puerco/vtrelease/pkg/release"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type PromoteOptions struct {
+	Version            string
+	StagingRegistry    string
+	ProductionRegistry string
+	All                bool
+}
+
+func AddPromote(parent *cobra.Command) {
+	opts := &PromoteOptions{}
+	cmd := &cobra.Command{
+		Use:   "promote --version=vM.m.p --production-registry=REGISTRY [--all | IMAGE_NAME...]",
+		Short: "Promote staged images to the production registry",
+		Long:  "Copy the staged images of a release to the production registry by digest, without rebuilding them",
+		Example: `  vtrelease promote --version=v12.0.4 --production-registry=docker.io/vitess --all
+  vtrelease promote --version=v12.0.4 --production-registry=docker.io/vitess vtgate vttablet`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if opts.All && len(args) > 0 {
+				return errors.New("image names cannot be specified with --all")
+			}
+			if !opts.All && len(args) == 0 {
+				return errors.New("you must specify the images to promote or --all")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPromote(opts, args)
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(
+		&opts.Version,
+		"version",
+		os.Getenv("VT_BASE_VER"),
+		"version tag to promote",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&opts.StagingRegistry,
+		"staging-registry",
+		release.DefaultPromoteOptions.StagingRegistry,
+		"registry where images are staged",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&opts.ProductionRegistry,
+		"production-registry",
+		release.DefaultPromoteOptions.ProductionRegistry,
+		"registry where images are promoted to",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&opts.All,
+		"all",
+		false,
+		"promote all the images found in the repository",
+	)
+
+	parent.AddCommand(cmd)
+}
+
+func runPromote(opts *PromoteOptions, images []string) error {
+	o := release.DefaultPromoteOptions
+	o.RepoPath = rootOpts.RepoPath
+	o.Version = opts.Version
+	o.StagingRegistry = opts.StagingRegistry
+	o.ProductionRegistry = opts.ProductionRegistry
+	o.Images = images
+	o.NoMock = rootOpts.NoMock
+
+	promoted, err := release.NewPromote(o).Run()
+	if err != nil {
+		return err
+	}
+	for _, p := range promoted {
+		logrus.Infof("✅ %s -> %s", p.Source, p.Destination)
+	}
+	return nil
+}
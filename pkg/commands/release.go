@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"github.com/puerco/vtrelease/pkg/release"
+	"github.com/spf13/cobra"
+)
+
+type ReleaseOptions struct {
+	Branch    string
+	Remote    string
+	StateFile string
+}
+
+func AddRelease(parent *cobra.Command) {
+	opts := &ReleaseOptions{}
+	cmd := &cobra.Command{
+		Use:           "release",
+		Short:         "Push the staged release branch and tags to the remote",
+		Long:          "Run the release phase of the vitess release, pushing what the stage created",
+		Example:       `  vtrelease release --branch=release-12.0 --remote=origin`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(*cobra.Command, []string) error {
+			return runRelease(opts)
+		},
+	}
+
+	cmd.PersistentFlags().StringVarP(
+		&opts.Branch,
+		"branch",
+		"b",
+		"",
+		"release branch that was staged. eg release-12.0",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&opts.Remote,
+		"remote",
+		release.DefaultReleaseOptions.Remote,
+		"git remote to push the release to",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&opts.StateFile,
+		"state-file",
+		"",
+		"state file written by the stage (defaults to a file named after the branch in the temp dir)",
+	)
+
+	parent.AddCommand(cmd)
+}
+
+func runRelease(opts *ReleaseOptions) error {
+	o := release.DefaultReleaseOptions
+	o.RepoPath = rootOpts.RepoPath
+	o.Branch = opts.Branch
+	o.Remote = opts.Remote
+	o.StateFile = opts.StateFile
+	o.NoMock = rootOpts.NoMock
+
+	return release.NewRelease(o).Run()
+}
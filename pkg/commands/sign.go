@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"errors"
+	"os"
+
+	"github.com/puerco/vtrelease/pkg/release"
+	"github.com/spf13/cobra"
+)
+
+type SignOptions struct {
+	Version       string
+	Registry      string
+	KeyPath       string
+	PublicKeyPath string
+	All           bool
+}
+
+func AddSign(parent *cobra.Command) {
+	opts := &SignOptions{}
+	checkArgs := func(cmd *cobra.Command, args []string) error {
+		if opts.All && len(args) > 0 {
+			return errors.New("image names cannot be specified with --all")
+		}
+		if !opts.All && len(args) == 0 {
+			return errors.New("you must specify the images or --all")
+		}
+		return nil
+	}
+
+	sign := &cobra.Command{
+		Use:   "sign --version=vM.m.p --key=KEY [--all | IMAGE_NAME...]",
+		Short: "Sign the container images of a release",
+		Long: `Sign the digest of every tag of the release images with an ECDSA key and
+store the signatures in the registry, in a format cosign can verify.
+
+Keys are unencrypted PEM files, they can be generated with openssl:
+
+  openssl ecparam -genkey -name prime256v1 | openssl pkcs8 -topk8 -nocrypt > vtrelease.key
+  openssl ec -in vtrelease.key -pubout > vtrelease.pub`,
+		Example:       `  vtrelease sign --version=v12.0.4 --key=vtrelease.key --all`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PreRunE:       checkArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return release.NewSign(signOptions(opts, args)).Run()
+		},
+	}
+
+	verify := &cobra.Command{
+		Use:           "verify-image --version=vM.m.p --public-key=KEY [--all | IMAGE_NAME...]",
+		Short:         "Verify the signatures of the container images of a release",
+		Example:       `  vtrelease verify-image --version=v12.0.4 --public-key=vtrelease.pub --all`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PreRunE:       checkArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return release.NewSign(signOptions(opts, args)).Verify()
+		},
+	}
+
+	for _, cmd := range []*cobra.Command{sign, verify} {
+		cmd.PersistentFlags().StringVar(
+			&opts.Version,
+			"version",
+			os.Getenv("VT_BASE_VER"),
+			"version tag of the images",
+		)
+
+		cmd.PersistentFlags().StringVar(
+			&opts.Registry,
+			"registry",
+			release.DefaultSignOptions.Registry,
+			"registry where the images live",
+		)
+
+		cmd.PersistentFlags().BoolVar(
+			&opts.All,
+			"all",
+			false,
+			"process all the images found in the repository",
+		)
+	}
+
+	sign.PersistentFlags().StringVar(
+		&opts.KeyPath,
+		"key",
+		"",
+		"path to the PEM encoded private key used to sign",
+	)
+
+	verify.PersistentFlags().StringVar(
+		&opts.PublicKeyPath,
+		"public-key",
+		"",
+		"path to the PEM encoded public key used to verify",
+	)
+
+	parent.AddCommand(sign, verify)
+}
+
+func signOptions(opts *SignOptions, images []string) release.SignOptions {
+	o := release.DefaultSignOptions
+	o.RepoPath = rootOpts.RepoPath
+	o.Version = opts.Version
+	o.Registry = opts.Registry
+	o.Images = images
+	o.KeyPath = opts.KeyPath
+	o.PublicKeyPath = opts.PublicKeyPath
+	o.NoMock = rootOpts.NoMock
+	return o
+}
@@ -1,13 +1,36 @@
 package commands
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
 	"github.com/puerco/vtrelease/pkg/release"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+const (
+	planOutputText = "text"
+	planOutputJSON = "json"
+)
+
+type PlanOptions struct {
+	Output string
+}
+
 type StageOptions struct {
 	Branch       string
 	GoDocVersion string
+	StateFile    string
+	Resume       bool
+	ReleaseType  string
+	Version      string
+	GitHubRepo   string
+	NotesCache   string
+	Offline      bool
+	SummaryFile  string
 }
 
 func AddStage(parent *cobra.Command) {
@@ -16,7 +39,7 @@ func AddStage(parent *cobra.Command) {
 		Use:           "stage",
 		Short:         "Run the staging phase of the vitess release",
 		Long:          "Run the staging phase of the vitess release",
-		Example:       `  vtrelease stage --version=12.0.4 `,
+		Example:       `  vtrelease stage --branch=release-12.0 --version=12.0.4`,
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		RunE: func(*cobra.Command, []string) error {
@@ -39,13 +62,149 @@ func AddStage(parent *cobra.Command) {
 		"godoc version to tag the release commit",
 	)
 
+	cmd.PersistentFlags().StringVar(
+		&opts.ReleaseType,
+		"type",
+		release.ReleaseTypePatch,
+		fmt.Sprintf(
+			"type of release to stage: %s (release candidate), %s (promote the last candidate) or %s",
+			release.ReleaseTypeRC, release.ReleaseTypeGA, release.ReleaseTypePatch,
+		),
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&opts.Version,
+		"version",
+		"",
+		"version to release instead of computing it from --type (for re-spins and out of order patches)",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&opts.StateFile,
+		"state-file",
+		"",
+		"file to persist the stage state (defaults to a file named after the branch in the temp dir)",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&opts.Resume,
+		"resume",
+		false,
+		"resume a failed run from the state file, skipping completed steps",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&opts.GitHubRepo,
+		"github-repository",
+		release.DefaultGitHubRepository,
+		"owner/name of the GitHub repository where the release notes pull requests are looked up",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&opts.NotesCache,
+		"notes-cache",
+		"",
+		"JSON file caching the pull requests listed in the release notes",
+	)
+
+	cmd.PersistentFlags().BoolVar(
+		&opts.Offline,
+		"offline",
+		false,
+		"generate the release notes only from the pull requests in --notes-cache",
+	)
+
+	cmd.PersistentFlags().StringVar(
+		&opts.SummaryFile,
+		"summary-file",
+		"",
+		"markdown summary to add at the top of the release notes (defaults to doc/releasenotes/M_m_p_summary.md)",
+	)
+
+	rollback := &cobra.Command{
+		Use:           "rollback",
+		Short:         "Undo a partially staged release",
+		Long:          "Reset the branch, delete the tags and remove the release notes created by a failed stage run",
+		Example:       `  vtrelease stage rollback --branch=release-12.0`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(*cobra.Command, []string) error {
+			return runStageRollback(opts)
+		},
+	}
+
+	planOpts := &PlanOptions{}
+	plan := &cobra.Command{
+		Use:           "plan",
+		Short:         "Print what the stage will do without modifying anything",
+		Long:          "Prepare the staging environment and print the release plan as text or JSON",
+		Example:       `  vtrelease stage plan --branch=release-12.0 --output=json`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(*cobra.Command, []string) error {
+			return runStagePlan(opts, planOpts)
+		},
+	}
+
+	plan.PersistentFlags().StringVarP(
+		&planOpts.Output,
+		"output",
+		"o",
+		planOutputText,
+		fmt.Sprintf("format of the plan, either %s or %s", planOutputText, planOutputJSON),
+	)
+
+	cmd.AddCommand(rollback, plan)
 	parent.AddCommand(cmd)
 }
 
 func runStage(opts *StageOptions) error {
-	return release.NewStage(release.StageOptions{
-		RepoPath:     rootOpts.RepoPath,
-		Branch:       opts.Branch,
-		GoDocVersion: opts.GoDocVersion,
-	}).Run()
+	return release.NewStage(stageOptions(opts)).Run()
+}
+
+func runStageRollback(opts *StageOptions) error {
+	undone, err := release.NewStage(stageOptions(opts)).Rollback()
+	for _, action := range undone {
+		logrus.Infof("  ↩️  %s", action)
+	}
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Rolled back %d changes", len(undone))
+	return nil
+}
+
+func runStagePlan(opts *StageOptions, planOpts *PlanOptions) error {
+	if planOpts.Output != planOutputText && planOpts.Output != planOutputJSON {
+		return errors.Errorf("invalid output format %q", planOpts.Output)
+	}
+
+	plan, err := release.NewStage(stageOptions(opts)).Plan()
+	if err != nil {
+		return errors.Wrap(err, "computing release plan")
+	}
+
+	if planOpts.Output == planOutputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(plan), "encoding plan")
+	}
+	return errors.Wrap(plan.WriteText(os.Stdout), "writing plan")
+}
+
+func stageOptions(opts *StageOptions) release.StageOptions {
+	return release.StageOptions{
+		RepoPath:         rootOpts.RepoPath,
+		Branch:           opts.Branch,
+		GoDocVersion:     opts.GoDocVersion,
+		NoMock:           rootOpts.NoMock,
+		StateFile:        opts.StateFile,
+		Resume:           opts.Resume,
+		ReleaseType:      opts.ReleaseType,
+		Version:          opts.Version,
+		GitHubRepository: opts.GitHubRepo,
+		NotesCache:       opts.NotesCache,
+		Offline:          opts.Offline,
+		SummaryFile:      opts.SummaryFile,
+	}
 }
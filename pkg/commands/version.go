@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/puerco/vtrelease/pkg/release"
+	"github.com/spf13/cobra"
+)
+
+func AddStampedVersion(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:           "stamped-version",
+		Short:         "Print the version stamped in the repository",
+		Long:          "Print the version set in go/vt/servenv/version.go of the vitess checkout",
+		Example:       `  vtrelease stamped-version --repo=$HOME/vitess`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(*cobra.Command, []string) error {
+			return runStampedVersion()
+		},
+	}
+	parent.AddCommand(cmd)
+}
+
+func runStampedVersion() error {
+	version, err := release.ReadVersionFile(rootOpts.RepoPath)
+	if err != nil {
+		return err
+	}
+	fmt.Println(version)
+	return nil
+}
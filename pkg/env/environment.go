@@ -15,6 +15,12 @@ import (
 
 const (
 	BranchPrefix = "release-"
+
+	// MainBranch is the development branch release branches are cut from
+	MainBranch = "main"
+
+	// RCPrefix is the pre-release identifier of release candidates
+	RCPrefix = "rc"
 )
 
 func New() *Environment {
@@ -60,8 +66,20 @@ func (o *Options) Validate() error {
 }
 
 // BranchVersion returns the major version of the branch we
-// are using, ie release-12.0 -> 12
+// are using, ie release-12.0 -> 12. On main, it is the major
+// version following the highest one tagged in the repository.
 func (e *Environment) BranchVersion() (int, error) {
+	if e.Options.Branch == MainBranch {
+		major, err := e.HighestMajorVersion()
+		if err != nil {
+			return 0, errors.Wrap(err, "getting highest major version")
+		}
+		if major == 0 {
+			return 0, errors.New("no version tags found to derive the main branch version")
+		}
+		return major + 1, nil
+	}
+
 	if strings.HasPrefix(e.Options.Branch, BranchPrefix) &&
 		strings.HasSuffix(e.Options.Branch, ".0") {
 		ver := strings.TrimSuffix(
@@ -73,10 +91,34 @@ func (e *Environment) BranchVersion() (int, error) {
 		}
 		return i, nil
 	}
-	// TODO: check if we can cut from main
 	return 0, nil
 }
 
+// HighestMajorVersion returns the highest major version tagged in the
+// repository, including pre-releases. Returns 0 if there are no tags.
+func (e *Environment) HighestMajorVersion() (int, error) {
+	tags, err := e.impl.GetRepoTags(&e.Options, e.Repository)
+	if err != nil {
+		return 0, errors.Wrap(err, "fetching tags from the repo")
+	}
+
+	var major uint64
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, "v") {
+			continue
+		}
+		ver, err := semver.Parse(tag[1:])
+		if err != nil {
+			logrus.Debugf("Ignoring non semver tag %s", tag)
+			continue
+		}
+		if ver.Major > major {
+			major = ver.Major
+		}
+	}
+	return int(major), nil
+}
+
 // NextVersion returns the next tag in the branch
 func (e *Environment) NextPatchVersion() (string, error) {
 	lastVer, err := e.LastVersion()
@@ -101,11 +143,25 @@ func (e *Environment) NextPatchVersion() (string, error) {
 		return "", errors.Wrap(err, "parsing last version tag")
 	}
 
+	if len(ver.Pre) > 0 {
+		return "", errors.Errorf("last version %s is a pre-release, the GA has to be cut first", lastVer)
+	}
+
 	return fmt.Sprintf("v%d.%d.%d", ver.Major, ver.Minor, ver.Patch+1), nil
 }
 
-// NextDevVersion returns the next tag in the branch
+// NextDevVersion returns the development version that follows the
+// next patch release in the branch
 func (e *Environment) NextDevVersion() (string, error) {
+	nextVer, err := e.NextPatchVersion()
+	if err != nil {
+		return "", errors.Wrap(err, "getting next patch version")
+	}
+	return DevVersion(nextVer)
+}
+
+// NextVersion returns the next tag in the branch
+func (e *Environment) NextMinorVersion() (string, error) {
 	lastVer, err := e.LastVersion()
 	if err != nil {
 		return "", errors.Wrap(err, "while getting last version from the repo")
@@ -120,7 +176,7 @@ func (e *Environment) NextDevVersion() (string, error) {
 		if branchVersion == 0 {
 			return "", errors.New("Unable to get major version from branch")
 		}
-		return fmt.Sprintf("v%d.%d.%d-SNAPSHOT", branchVersion, 0, 1), nil
+		return fmt.Sprintf("v%d.%d.%d", branchVersion, 0, 0), nil
 	}
 
 	ver, err := semver.Parse(lastVer[1:])
@@ -128,17 +184,58 @@ func (e *Environment) NextDevVersion() (string, error) {
 		return "", errors.Wrap(err, "parsing last version tag")
 	}
 
-	return fmt.Sprintf("v%d.%d.%d-SNAPSHOT", ver.Major, ver.Minor, ver.Patch+2), nil
+	if len(ver.Pre) > 0 {
+		return "", errors.Errorf("last version %s is a pre-release, the GA has to be cut first", lastVer)
+	}
+
+	return fmt.Sprintf("v%d.%d.%d", ver.Major, ver.Minor+1, 0), nil
 }
 
-// NextVersion returns the next tag in the branch
-func (e *Environment) NextMinorVersion() (string, error) {
+// NextRCVersion returns the next release candidate in the branch. The
+// first one is vN.0.0-rc1, subsequent ones increment the rc number.
+func (e *Environment) NextRCVersion() (string, error) {
+	lastVer, err := e.LastVersion()
+	if err != nil {
+		return "", errors.Wrap(err, "while getting last version from the repo")
+	}
+
+	if lastVer == "" {
+		branchVersion, err := e.BranchVersion()
+		if err != nil {
+			return "", errors.Wrap(err, "getting branch version")
+		}
+		if branchVersion == 0 {
+			return "", errors.New("Unable to get major version from branch")
+		}
+		return fmt.Sprintf("v%d.%d.%d-%s1", branchVersion, 0, 0, RCPrefix), nil
+	}
+
+	ver, err := semver.Parse(lastVer[1:])
+	if err != nil {
+		return "", errors.Wrap(err, "parsing last version tag")
+	}
+
+	if len(ver.Pre) == 0 {
+		return "", errors.Errorf("last version %s is already GA, cannot cut a release candidate", lastVer)
+	}
+
+	prefix, num, ok := splitPreRelease(ver.Pre)
+	if !ok || prefix != RCPrefix {
+		return "", errors.Errorf("unable to determine release candidate number from %s", lastVer)
+	}
+
+	return fmt.Sprintf("v%d.%d.%d-%s%d", ver.Major, ver.Minor, ver.Patch, RCPrefix, num+1), nil
+}
+
+// NextGAVersion returns the version that promotes the last release
+// candidate in the branch to GA. If there are no tags, the branch is
+// released directly as vN.0.0.
+func (e *Environment) NextGAVersion() (string, error) {
 	lastVer, err := e.LastVersion()
 	if err != nil {
 		return "", errors.Wrap(err, "while getting last version from the repo")
 	}
 
-	/// If last version is an empty string, set the 0.0 for the branch
 	if lastVer == "" {
 		branchVersion, err := e.BranchVersion()
 		if err != nil {
@@ -155,7 +252,75 @@ func (e *Environment) NextMinorVersion() (string, error) {
 		return "", errors.Wrap(err, "parsing last version tag")
 	}
 
-	return fmt.Sprintf("v%d.%d.%d", ver.Major, ver.Minor+1, 0), nil
+	if len(ver.Pre) == 0 {
+		return "", errors.Errorf("last version %s is already GA", lastVer)
+	}
+
+	return fmt.Sprintf("v%d.%d.%d", ver.Major, ver.Minor, ver.Patch), nil
+}
+
+// DevVersion returns the development version that follows a release. A
+// pre-release is followed by the snapshot of its GA, ie v13.0.0-rc1 ->
+// v13.0.0-SNAPSHOT, a GA by the snapshot of the next patch, ie
+// v12.0.4 -> v12.0.5-SNAPSHOT.
+func DevVersion(version string) (string, error) {
+	ver, err := semver.Parse(strings.TrimPrefix(version, "v"))
+	if err != nil {
+		return "", errors.Wrapf(err, "parsing version %s", version)
+	}
+	if len(ver.Pre) > 0 {
+		return fmt.Sprintf("v%d.%d.%d-SNAPSHOT", ver.Major, ver.Minor, ver.Patch), nil
+	}
+	return fmt.Sprintf("v%d.%d.%d-SNAPSHOT", ver.Major, ver.Minor, ver.Patch+1), nil
+}
+
+// ValidateVersion checks that version can be released from the branch:
+// its major must match the branch, it must be greater than the last
+// version released and it must not be tagged already. Returns the
+// version normalized with a v prefix.
+func (e *Environment) ValidateVersion(version string) (string, error) {
+	tag := "v" + strings.TrimPrefix(version, "v")
+	ver, err := semver.Parse(tag[1:])
+	if err != nil {
+		return "", errors.Wrapf(err, "parsing version %s", version)
+	}
+
+	branchVersion, err := e.BranchVersion()
+	if err != nil {
+		return "", errors.Wrap(err, "getting branch version")
+	}
+	if ver.Major != uint64(branchVersion) {
+		return "", errors.Errorf(
+			"version %s cannot be released from branch %s", tag, e.Options.Branch,
+		)
+	}
+
+	tags, err := e.impl.GetRepoTags(&e.Options, e.Repository)
+	if err != nil {
+		return "", errors.Wrap(err, "fetching tags from the repo")
+	}
+	for _, t := range tags {
+		if t == tag {
+			return "", errors.Errorf("version %s is already tagged", tag)
+		}
+	}
+
+	lastVer, err := e.LastVersion()
+	if err != nil {
+		return "", errors.Wrap(err, "while getting last version from the repo")
+	}
+	if lastVer != "" {
+		last, err := semver.Parse(lastVer[1:])
+		if err != nil {
+			return "", errors.Wrap(err, "parsing last version tag")
+		}
+		if CompareVersions(ver, last) <= 0 {
+			return "", errors.Errorf(
+				"version %s is not greater than the last version %s", tag, lastVer,
+			)
+		}
+	}
+	return tag, nil
 }
 
 // LastVersion checks the branch for tags and returns the last cut
@@ -174,35 +339,65 @@ func (e *Environment) LastVersion() (string, error) {
 		return "", errors.New("Unable to get major version from branch")
 	}
 
-	var greatMinor, greatPatch int
-	var seen bool
+	var last *semver.Version
 	for _, tag := range tags {
 		if !strings.HasPrefix(tag, fmt.Sprintf("v%d.", branchVersion)) {
 			continue
 		}
-		seen = true
 		ver, err := semver.Parse(tag[1:])
 		if err != nil {
 			return "", errors.Wrap(err, "parsing semantic version tag ")
 		}
 
-		if ver.Minor > uint64(greatMinor) {
-			greatMinor = int(ver.Minor)
-			greatPatch = int(ver.Patch)
-		}
-		if ver.Minor == uint64(greatMinor) {
-			if ver.Patch > uint64(greatPatch) {
-				greatPatch = int(ver.Patch)
-			}
+		if last == nil || CompareVersions(ver, *last) > 0 {
+			last = &ver
 		}
 	}
 
 	// If there are nm tags, then its a new branch and we return 0
-	if !seen {
+	if last == nil {
 		logrus.Warn("No tags found in the branch. Assuming new branch.")
 		return "", nil
 	}
-	return fmt.Sprintf("v%d.%d.%d", branchVersion, greatMinor, greatPatch), nil
+	return "v" + last.String(), nil
+}
+
+// CompareVersions compares two versions like semver does but ordering
+// numbered pre-releases by their number, so that rc2 < rc10. Returns
+// -1, 0 or 1 if a is lower, equal or greater than b.
+func CompareVersions(a, b semver.Version) int {
+	aPrefix, aNum, aOk := splitPreRelease(a.Pre)
+	bPrefix, bNum, bOk := splitPreRelease(b.Pre)
+	if !aOk || !bOk || aPrefix != bPrefix ||
+		a.Major != b.Major || a.Minor != b.Minor || a.Patch != b.Patch {
+		return a.Compare(b)
+	}
+	switch {
+	case aNum < bNum:
+		return -1
+	case aNum > bNum:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// splitPreRelease splits a single pre-release identifier like rc2 into
+// its prefix and number. Returns false if it does not have that form.
+func splitPreRelease(pre []semver.PRVersion) (prefix string, num uint64, ok bool) {
+	if len(pre) != 1 || pre[0].IsNum {
+		return "", 0, false
+	}
+	id := pre[0].VersionStr
+	i := strings.IndexFunc(id, func(r rune) bool { return r >= '0' && r <= '9' })
+	if i <= 0 {
+		return "", 0, false
+	}
+	n, err := strconv.ParseUint(id[i:], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return id[:i], n, true
 }
 
 func (e *Environment) CheckoutBranch() error {
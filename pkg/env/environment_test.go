@@ -21,8 +21,15 @@ func TestLastVersion(t *testing.T) {
 		{"v12.1.3", "release-12.0", []string{"v12.1.3", "v12.1.1", "v12.1.2"}, false},
 		// Tags  from other branches
 		{"v12.1.1", "release-12.0", []string{"v13.1.3", "v12.1.1", "v11.1.2"}, false},
-		// Tags  from other branches
-		{"v12.0.0", "release-12.0", []string{}, false},
+		// No tags in the branch, it is a new one
+		{"", "release-12.0", []string{}, false},
+		// Release candidates sort before the GA
+		{"v13.0.0", "release-13.0", []string{"v13.0.0-rc1", "v13.0.0", "v13.0.0-rc2"}, false},
+		{"v13.0.0-rc2", "release-13.0", []string{"v13.0.0-rc2", "v13.0.0-rc1", "v12.0.3"}, false},
+		// Release candidate numbers are compared numerically
+		{"v13.0.0-rc10", "release-13.0", []string{"v13.0.0-rc9", "v13.0.0-rc10", "v13.0.0-rc2"}, false},
+		// Patch releases after the GA
+		{"v13.0.1", "release-13.0", []string{"v13.0.0-rc1", "v13.0.1", "v13.0.0"}, false},
 		// Malformed branch
 		{"v12.0.0", "release-12", []string{}, true},
 	} {
@@ -43,3 +50,138 @@ func TestLastVersion(t *testing.T) {
 		}
 	}
 }
+
+func TestNextVersions(t *testing.T) {
+	for _, tc := range []struct {
+		tags        []string
+		nextPatch   string
+		nextRC      string
+		nextGA      string
+		nextDev     string
+		shouldError [4]bool
+	}{
+		// New branch
+		{[]string{}, "v13.0.0", "v13.0.0-rc1", "v13.0.0", "v13.0.1-SNAPSHOT", [4]bool{}},
+		// After the first release candidate
+		{[]string{"v13.0.0-rc1"}, "", "v13.0.0-rc2", "v13.0.0", "", [4]bool{true, false, false, true}},
+		{[]string{"v13.0.0-rc1", "v13.0.0-rc2"}, "", "v13.0.0-rc3", "v13.0.0", "", [4]bool{true, false, false, true}},
+		// After the GA only patches can be cut
+		{[]string{"v13.0.0-rc1", "v13.0.0"}, "v13.0.1", "", "", "v13.0.2-SNAPSHOT", [4]bool{false, true, true, false}},
+		{[]string{"v13.0.0", "v13.0.1"}, "v13.0.2", "", "", "v13.0.3-SNAPSHOT", [4]bool{false, true, true, false}},
+	} {
+		sut := env.Environment{
+			Options: env.Options{Branch: "release-13.0"},
+		}
+		fake := &envfakes.FakeImplementation{}
+		fake.GetRepoTagsReturns(tc.tags, nil)
+		sut.SetImplementation(fake)
+
+		for i, f := range []struct {
+			fn       func() (string, error)
+			expected string
+		}{
+			{sut.NextPatchVersion, tc.nextPatch},
+			{sut.NextRCVersion, tc.nextRC},
+			{sut.NextGAVersion, tc.nextGA},
+			{sut.NextDevVersion, tc.nextDev},
+		} {
+			ver, err := f.fn()
+			if tc.shouldError[i] {
+				require.Error(t, err, "tags %v", tc.tags)
+			} else {
+				require.NoError(t, err, "tags %v", tc.tags)
+				require.Equal(t, f.expected, ver, "tags %v", tc.tags)
+			}
+		}
+	}
+}
+
+func TestDevVersion(t *testing.T) {
+	for _, tc := range []struct {
+		version     string
+		expected    string
+		shouldError bool
+	}{
+		{"v12.0.4", "v12.0.5-SNAPSHOT", false},
+		{"v13.0.0-rc1", "v13.0.0-SNAPSHOT", false},
+		{"13.0.0", "v13.0.1-SNAPSHOT", false},
+		{"vthirteen", "", true},
+	} {
+		ver, err := env.DevVersion(tc.version)
+		if tc.shouldError {
+			require.Error(t, err)
+		} else {
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, ver)
+		}
+	}
+}
+
+func TestMainBranchVersion(t *testing.T) {
+	for _, tc := range []struct {
+		tags          []string
+		expectedMajor int
+		shouldError   bool
+	}{
+		{[]string{"v12.0.3", "v13.0.0-rc1", "v11.0.0"}, 14, false},
+		{[]string{"v13.0.0", "v13.0.1", "not-a-version", "v0.13.1"}, 14, false},
+		{[]string{}, 0, true},
+	} {
+		sut := env.Environment{
+			Options: env.Options{Branch: env.MainBranch},
+		}
+		fake := &envfakes.FakeImplementation{}
+		fake.GetRepoTagsReturns(tc.tags, nil)
+		sut.SetImplementation(fake)
+
+		major, err := sut.BranchVersion()
+		if tc.shouldError {
+			require.Error(t, err)
+		} else {
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedMajor, major)
+		}
+	}
+}
+
+func TestValidateVersion(t *testing.T) {
+	for _, tc := range []struct {
+		version     string
+		tags        []string
+		expected    string
+		shouldError bool
+	}{
+		// Next patch
+		{"v12.0.4", []string{"v12.0.2", "v12.0.3"}, "v12.0.4", false},
+		// Without the v prefix
+		{"12.0.4", []string{"v12.0.3"}, "v12.0.4", false},
+		// Out of order patch
+		{"v12.0.6", []string{"v12.0.3"}, "v12.0.6", false},
+		// First release in the branch
+		{"v12.0.0-rc1", []string{"v11.0.3"}, "v12.0.0-rc1", false},
+		// Major does not match the branch
+		{"v13.0.0", []string{"v12.0.3"}, "", true},
+		// Already tagged
+		{"v12.0.3", []string{"v12.0.3"}, "", true},
+		// Lower than the last version
+		{"v12.0.2", []string{"v12.0.3"}, "", true},
+		{"v12.0.0-rc1", []string{"v12.0.0"}, "", true},
+		// Not semver
+		{"twelve", []string{"v12.0.3"}, "", true},
+	} {
+		sut := env.Environment{
+			Options: env.Options{Branch: "release-12.0"},
+		}
+		fake := &envfakes.FakeImplementation{}
+		fake.GetRepoTagsReturns(tc.tags, nil)
+		sut.SetImplementation(fake)
+
+		ver, err := sut.ValidateVersion(tc.version)
+		if tc.shouldError {
+			require.Error(t, err, tc.version)
+		} else {
+			require.NoError(t, err, tc.version)
+			require.Equal(t, tc.expected, ver)
+		}
+	}
+}
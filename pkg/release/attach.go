@@ -0,0 +1,173 @@
+package release
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/pkg/errors"
+)
+
+// attachedTag returns the tag where artifacts of kind suffix attached
+// to the image digest are stored. Following the cosign conventions, the
+// tag lives in the image repository and is named sha256-<hex>.<suffix>
+func attachedTag(digest name.Digest, suffix string) (name.Tag, error) {
+	tag := fmt.Sprintf("%s.%s", strings.Replace(digest.DigestStr(), ":", "-", 1), suffix)
+	return name.NewTag(fmt.Sprintf("%s:%s", digest.Context().Name(), tag))
+}
+
+// attachedTagDigest returns the digest an attached artifacts tag, ie
+// sha256-<hex>.sig, belongs to. Returns false if tag is not one.
+func attachedTagDigest(tag string) (string, bool) {
+	parts := strings.SplitN(tag, ".", 2)
+	if len(parts) != 2 || !stringInSlice(
+		parts[1], []string{signatureTagSuffix, attestationTagSuffix, sbomTagSuffix},
+	) {
+		return "", false
+	}
+	digest, err := v1.NewHash(strings.Replace(parts[0], "-", ":", 1))
+	if err != nil {
+		return "", false
+	}
+	return digest.String(), true
+}
+
+// attachedImage fetches the image holding the artifacts in tag. It
+// returns nil if nothing has been attached yet.
+func attachedImage(tag name.Tag) (v1.Image, error) {
+	img, err := remote.Image(tag, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == 404 {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "fetching %s", tag)
+	}
+	return img, nil
+}
+
+// layerMatcher selects the attached layers that a new layer replaces
+type layerMatcher func(desc v1.Descriptor) bool
+
+// withMediaType matches the layers of a media type
+func withMediaType(mediaType types.MediaType) layerMatcher {
+	return func(desc v1.Descriptor) bool {
+		return desc.MediaType == mediaType
+	}
+}
+
+// withAnnotation matches the layers annotated with key set to value
+func withAnnotation(key, value string) layerMatcher {
+	return func(desc v1.Descriptor) bool {
+		return desc.Annotations[key] == value
+	}
+}
+
+// attachLayer adds a layer with its annotations to the artifacts image
+// stored in tag, creating it if needed. Attached layers with the same
+// content or selected by replace are dropped so that attaching the same
+// artifact again does not stack duplicates.
+func attachLayer(tag name.Tag, layer v1.Layer, annotations map[string]string, replace layerMatcher) error {
+	digest, err := layer.Digest()
+	if err != nil {
+		return errors.Wrap(err, "getting layer digest")
+	}
+	existing, err := attachedImage(tag)
+	if err != nil {
+		return err
+	}
+
+	addenda := []mutate.Addendum{}
+	if existing != nil {
+		manifest, err := existing.Manifest()
+		if err != nil {
+			return errors.Wrapf(err, "reading manifest of %s", tag)
+		}
+		for _, desc := range manifest.Layers {
+			if desc.Digest == digest || (replace != nil && replace(desc)) {
+				continue
+			}
+			l, err := existing.LayerByDigest(desc.Digest)
+			if err != nil {
+				return errors.Wrapf(err, "getting layer %s", desc.Digest)
+			}
+			addenda = append(addenda, mutate.Addendum{Layer: l, Annotations: desc.Annotations})
+		}
+	}
+	addenda = append(addenda, mutate.Addendum{Layer: layer, Annotations: annotations})
+
+	base := mutate.ConfigMediaType(
+		mutate.MediaType(empty.Image, types.OCIManifestSchema1), types.OCIConfigJSON,
+	)
+	img, err := mutate.Append(base, addenda...)
+	if err != nil {
+		return errors.Wrap(err, "appending layer")
+	}
+	return errors.Wrapf(
+		remote.Write(tag, img, remote.WithAuthFromKeychain(authn.DefaultKeychain)),
+		"writing %s", tag,
+	)
+}
+
+// attachedLayer is a layer read from an artifacts image
+type attachedLayer struct {
+	MediaType   types.MediaType
+	Annotations map[string]string
+	Content     []byte
+}
+
+// attachedLayers reads the layers attached to an image in tag
+func attachedLayers(tag name.Tag) ([]attachedLayer, error) {
+	img, err := attachedImage(tag)
+	if err != nil {
+		return nil, err
+	}
+	if img == nil {
+		return nil, nil
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading manifest")
+	}
+	layers := []attachedLayer{}
+	for _, desc := range manifest.Layers {
+		layer, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting layer %s", desc.Digest)
+		}
+		content, err := readLayer(layer)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading layer %s", desc.Digest)
+		}
+		layers = append(layers, attachedLayer{
+			MediaType:   desc.MediaType,
+			Annotations: desc.Annotations,
+			Content:     content,
+		})
+	}
+	return layers, nil
+}
+
+// readLayer returns the raw blob of a layer. Attached artifacts are
+// stored uncompressed.
+func readLayer(layer v1.Layer) ([]byte, error) {
+	rc, err := layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	var b bytes.Buffer
+	if _, err := io.Copy(&b, rc); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
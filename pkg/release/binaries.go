@@ -0,0 +1,60 @@
+package release
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Binaries compiles the vitess binaries from the commit of the release
+// tag for each platform, packages them in tarballs and writes their
+// checksums to the artifacts directory. Returns the tarball paths.
+func (b *Build) Binaries() ([]string, error) {
+	if err := b.impl.ValidateBinariesOpts(&b.Options, &b.State); err != nil {
+		return nil, errors.Wrap(err, "validating binaries build options")
+	}
+
+	srcDir, commit, err := b.impl.CheckoutSource(&b.Options, &b.State)
+	if err != nil {
+		return nil, errors.Wrap(err, "checking out release source")
+	}
+	defer func() {
+		if err := b.impl.RemoveSource(&b.Options, srcDir); err != nil {
+			logrus.Warnf("Unable to remove source checkout %s: %v", srcDir, err)
+		}
+	}()
+
+	tarballs := []string{}
+	for _, platform := range b.Options.Platforms {
+		logrus.Infof("🔨 Compiling vitess %s binaries for %s", b.Options.VTBaseVersion, platform)
+		binDir, err := b.impl.CompileBinaries(&b.Options, &b.State, srcDir, commit, platform)
+		if err != nil {
+			return nil, errors.Wrapf(err, "compiling binaries for %s", platform)
+		}
+		tarball, err := b.impl.PackageBinaries(
+			&b.Options, &b.State, srcDir, binDir, binariesPackageName(b.Options.VTBaseVersion, commit, platform),
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "packaging binaries for %s", platform)
+		}
+		tarballs = append(tarballs, tarball)
+	}
+
+	if err := b.impl.WriteChecksums(&b.Options, binariesDir(&b.Options), tarballs); err != nil {
+		return nil, errors.Wrap(err, "writing checksums")
+	}
+	return tarballs, nil
+}
+
+// binariesPackageName returns the name of the binaries tarball, eg
+// vitess-12.0.4-5a31c4e-linux-amd64
+func binariesPackageName(version, commit, platform string) string {
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+	return fmt.Sprintf(
+		"vitess-%s-%s-%s", strings.TrimPrefix(version, "v"), commit, strings.ReplaceAll(platform, "/", "-"),
+	)
+}
@@ -0,0 +1,319 @@
+package release
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/release-sdk/git"
+	"sigs.k8s.io/release-utils/command"
+	"sigs.k8s.io/release-utils/util"
+)
+
+const (
+	// binariesPackages are the main packages compiled for the release
+	binariesPackages = "./go/cmd/..."
+
+	// servenvPackage holds the build information variables stamped in
+	// the binaries
+	servenvPackage = "vitess.io/vitess/go/vt/servenv"
+
+	checksumsFile = "SHA256SUMS"
+)
+
+// binariesDir returns the directory where the tarballs are written
+func binariesDir(o *BuildOptions) string {
+	return filepath.Join(o.ArtifactsDir, "binaries")
+}
+
+// ValidateBinariesOpts checks the options needed to build the binaries
+// and that the version is tagged in the repository
+func (di *defaultBuildImplementation) ValidateBinariesOpts(o *BuildOptions, s *State) error {
+	problems := []string{}
+	if o.RepoPath == "" {
+		problems = append(problems, "path to repository not defined")
+	}
+	if o.VTBaseVersion == "" {
+		problems = append(problems, "version to build not defined")
+	} else if _, err := semver.Parse(strings.TrimPrefix(o.VTBaseVersion, "v")); err != nil {
+		problems = append(problems, fmt.Sprintf("version %q is not a valid semantic version", o.VTBaseVersion))
+	}
+	if len(o.Platforms) == 0 {
+		problems = append(problems, "no platforms defined to build the binaries")
+	}
+	for _, platform := range o.Platforms {
+		if _, err := goPlatformEnv(platform); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return validationError("invalid build options", problems)
+	}
+
+	repo, err := git.OpenRepo(o.RepoPath)
+	if err != nil {
+		return errors.Wrap(err, "opening repository")
+	}
+	tags, err := repo.Tags()
+	if err != nil {
+		return errors.Wrap(err, "listing repository tags")
+	}
+	if !stringInSlice(o.VTBaseVersion, tags) {
+		problems = append(problems, fmt.Sprintf("version %s is not tagged in the repository", o.VTBaseVersion))
+	}
+	return validationError("invalid build options", problems)
+}
+
+// CheckoutSource creates a worktree of the repository at the release tag
+// so the binaries are built from the tagged commit regardless of the
+// branch checked out. Returns its path and the commit.
+func (di *defaultBuildImplementation) CheckoutSource(o *BuildOptions, s *State) (dir, commit string, err error) {
+	commit, err = di.SourceCommit(o, s)
+	if err != nil {
+		return "", "", err
+	}
+	tmp, err := os.MkdirTemp("", "vtrelease-source-")
+	if err != nil {
+		return "", "", errors.Wrap(err, "creating source directory")
+	}
+	dir = filepath.Join(tmp, "vitess")
+	if err := command.NewWithWorkDir(
+		o.RepoPath, "git", "worktree", "add", "--detach", dir, commit,
+	).RunSilentSuccess(); err != nil {
+		os.RemoveAll(tmp)
+		return "", "", errors.Wrapf(err, "creating worktree at %s", commit)
+	}
+	return dir, commit, nil
+}
+
+// RemoveSource deletes the worktree created by CheckoutSource
+func (di *defaultBuildImplementation) RemoveSource(o *BuildOptions, dir string) error {
+	if err := command.NewWithWorkDir(
+		o.RepoPath, "git", "worktree", "remove", "--force", dir,
+	).RunSilentSuccess(); err != nil {
+		return errors.Wrap(err, "removing worktree")
+	}
+	return os.RemoveAll(filepath.Dir(dir))
+}
+
+// CompileBinaries cross compiles the vitess binaries for a platform
+// stamping the build information. Returns the directory with the
+// compiled binaries.
+func (di *defaultBuildImplementation) CompileBinaries(
+	o *BuildOptions, s *State, srcDir, commit, platform string,
+) (string, error) {
+	env, err := goPlatformEnv(platform)
+	if err != nil {
+		return "", err
+	}
+	binDir := filepath.Join(filepath.Dir(srcDir), "bin", strings.ReplaceAll(platform, "/", "-"))
+	if err := os.MkdirAll(binDir, os.FileMode(0o755)); err != nil {
+		return "", errors.Wrap(err, "creating binaries directory")
+	}
+	if err := command.NewWithWorkDir(
+		srcDir, "go", goBuildArgs(o.VTBaseVersion, commit, binDir)...,
+	).Env(env...).RunSuccess(); err != nil {
+		return "", errors.Wrap(err, "running go build")
+	}
+	return binDir, nil
+}
+
+// goBuildArgs returns the arguments to go build that compile the
+// binaries into binDir with the build information of the release
+func goBuildArgs(version, commit, binDir string) []string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	username := "unknown"
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	stamp := map[string]string{
+		"buildHost":      host,
+		"buildUser":      username,
+		"buildTime":      time.Now().UTC().Format(time.UnixDate),
+		"buildGitRev":    commit,
+		"buildGitBranch": version,
+	}
+	ldflags := []string{}
+	for _, k := range sortedKeys(stamp) {
+		ldflags = append(ldflags, fmt.Sprintf("-X '%s.%s=%s'", servenvPackage, k, stamp[k]))
+	}
+	return []string{
+		"build", "-trimpath", "-ldflags", strings.Join(ldflags, " "),
+		"-o", binDir + string(filepath.Separator), binariesPackages,
+	}
+}
+
+// goPlatformEnv returns the environment to cross compile for a platform
+func goPlatformEnv(platform string) ([]string, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return nil, errors.Errorf("invalid platform %q, must be os/arch[/variant]", platform)
+	}
+	env := []string{"CGO_ENABLED=0", "GOOS=" + parts[0], "GOARCH=" + parts[1]}
+	if len(parts) == 3 && parts[1] == "arm" {
+		env = append(env, "GOARM="+strings.TrimPrefix(parts[2], "v"))
+	}
+	return env, nil
+}
+
+// PackageBinaries writes a tarball with the binaries, the license and
+// readme of the repository, and its SBOM, to the artifacts directory
+func (di *defaultBuildImplementation) PackageBinaries(
+	o *BuildOptions, s *State, srcDir, binDir, packageName string,
+) (string, error) {
+	dir := binariesDir(o)
+	if err := os.MkdirAll(dir, os.FileMode(0o755)); err != nil {
+		return "", errors.Wrap(err, "creating binaries directory")
+	}
+	entries, err := os.ReadDir(binDir)
+	if err != nil {
+		return "", errors.Wrap(err, "reading binaries")
+	}
+
+	doc := &sbom{Name: packageName, Version: o.VTBaseVersion, Created: time.Now().UTC()}
+	files := map[string]string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(binDir, entry.Name())
+		files[filepath.Join("bin", entry.Name())] = path
+		binary, err := os.ReadFile(path)
+		if err != nil {
+			return "", errors.Wrapf(err, "reading %s", path)
+		}
+		doc.addPackages(goModules(binary)...)
+	}
+	if len(files) == 0 {
+		return "", errors.Errorf("no binaries found in %s", binDir)
+	}
+	for _, doc := range []string{"LICENSE", "README.md"} {
+		if util.Exists(filepath.Join(srcDir, doc)) {
+			files[doc] = filepath.Join(srcDir, doc)
+		}
+	}
+
+	tarball := filepath.Join(dir, packageName+".tar.gz")
+	if err := writeTarball(tarball, packageName, files); err != nil {
+		return "", errors.Wrapf(err, "writing %s", tarball)
+	}
+
+	sbomDir := filepath.Join(o.ArtifactsDir, "sbom")
+	if err := os.MkdirAll(sbomDir, os.FileMode(0o755)); err != nil {
+		return "", errors.Wrap(err, "creating sbom directory")
+	}
+	for ext, render := range map[string]func() ([]byte, error){
+		"spdx.json": doc.SPDX,
+		"cdx.json":  doc.CycloneDX,
+	} {
+		data, err := render()
+		if err != nil {
+			return "", err
+		}
+		path := filepath.Join(sbomDir, fmt.Sprintf("%s.%s", packageName, ext))
+		if err := os.WriteFile(path, data, os.FileMode(0o644)); err != nil {
+			return "", errors.Wrapf(err, "writing %s", path)
+		}
+	}
+	logrus.Infof("📦 Packaged %d binaries in %s", len(entries), tarball)
+	return tarball, nil
+}
+
+// writeTarball writes a gzipped tarball with files, a map of paths in
+// the tarball to paths in disk, under a top directory
+func writeTarball(path, topDir string, files map[string]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := addTarFile(tw, filepath.ToSlash(filepath.Join(topDir, name)), files[name]); err != nil {
+			return errors.Wrapf(err, "adding %s", name)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// addTarFile copies a file from disk into a tarball
+func addTarFile(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	hdr.Uname, hdr.Gname = "root", "root"
+	hdr.Uid, hdr.Gid = 0, 0
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// WriteChecksums writes the SHA256SUMS file of the artifacts in dir
+func (di *defaultBuildImplementation) WriteChecksums(o *BuildOptions, dir string, files []string) error {
+	var sums strings.Builder
+	for _, path := range files {
+		sum, err := sha256File(path)
+		if err != nil {
+			return errors.Wrapf(err, "hashing %s", path)
+		}
+		fmt.Fprintf(&sums, "%s  %s\n", sum, filepath.Base(path))
+	}
+	path := filepath.Join(dir, checksumsFile)
+	return errors.Wrapf(
+		os.WriteFile(path, []byte(sums.String()), os.FileMode(0o644)), "writing %s", path,
+	)
+}
+
+// sha256File returns the hex encoded sha256 digest of a file
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,125 @@
+package release
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestGoRepo creates a tagged repository with a minimal vitess go
+// module with one command printing its build information
+func newTestGoRepo(t *testing.T, version string) (repoPath, commit string) {
+	repoPath = t.TempDir()
+	for path, content := range map[string]string{
+		"go.mod":                   "module vitess.io/vitess\n\ngo 1.17\n",
+		"LICENSE":                  "Apache License\n",
+		"go/vt/servenv/version.go": "package servenv\n\nconst versionName = \"" + strings.TrimPrefix(version, "v") + "\"\n",
+		"go/vt/servenv/buildinfo.go": "package servenv\n\nvar (\n\tbuildHost = \"\"\n\tbuildUser = \"\"\n" +
+			"\tbuildTime = \"\"\n\tbuildGitRev = \"\"\n\tbuildGitBranch = \"\"\n)\n\n" +
+			"func Info() string { return versionName + \" \" + buildGitRev + \" \" + buildGitBranch }\n",
+		"go/cmd/vtgate/main.go": "package main\n\nimport (\n\t\"fmt\"\n\n\t\"vitess.io/vitess/go/vt/servenv\"\n)\n\n" +
+			"func main() { fmt.Println(servenv.Info()) }\n",
+		"go/cmd/vtgate/flags/flags.go": "package flags\n",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(repoPath, filepath.Dir(path)), os.FileMode(0o755)))
+		require.NoError(t, os.WriteFile(filepath.Join(repoPath, path), []byte(content), os.FileMode(0o644)))
+	}
+	return repoPath, commitAndTag(t, repoPath, version)
+}
+
+// tarballFiles returns the names of the files in a gzipped tarball
+func tarballFiles(t *testing.T, path string) []string {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(zr)
+	files := []string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		files = append(files, hdr.Name)
+	}
+	return files
+}
+
+func TestBuildBinaries(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not found")
+	}
+	repoPath, commit := newTestGoRepo(t, "v12.0.4")
+	// Changes after the tag are not built
+	require.NoError(t, os.WriteFile(
+		filepath.Join(repoPath, "go/vt/servenv/version.go"),
+		[]byte("package servenv\n\nconst versionName = \"12.0.5-SNAPSHOT\"\n"), os.FileMode(0o644),
+	))
+	runGit(t, repoPath, "commit", "-am", "Back to dev mode")
+
+	opts := DefaultBuildOptions
+	opts.RepoPath = repoPath
+	opts.VTBaseVersion = "v12.0.4"
+	opts.ArtifactsDir = t.TempDir()
+	opts.NoMock = true
+
+	tarballs, err := NewBuild(opts).Binaries()
+	require.NoError(t, err)
+	short := commit[:7]
+	dir := filepath.Join(opts.ArtifactsDir, "binaries")
+	require.Equal(t, []string{
+		filepath.Join(dir, fmt.Sprintf("vitess-12.0.4-%s-linux-amd64.tar.gz", short)),
+		filepath.Join(dir, fmt.Sprintf("vitess-12.0.4-%s-linux-arm64.tar.gz", short)),
+	}, tarballs)
+
+	top := fmt.Sprintf("vitess-12.0.4-%s-linux-amd64", short)
+	require.Equal(t, []string{top + "/LICENSE", top + "/bin/vtgate"}, tarballFiles(t, tarballs[0]))
+
+	sums, err := os.ReadFile(filepath.Join(dir, checksumsFile))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(sums)), "\n")
+	require.Len(t, lines, 2)
+	for i, tarball := range tarballs {
+		sum, err := sha256File(tarball)
+		require.NoError(t, err)
+		require.Equal(t, sum+"  "+filepath.Base(tarball), lines[i])
+	}
+
+	// The worktree is cleaned up
+	require.NotContains(t, runGit(t, repoPath, "worktree", "list"), "vtrelease-source-")
+
+	// Binaries SBOMs list the modules compiled in
+	spdx, err := os.ReadFile(filepath.Join(opts.ArtifactsDir, "sbom", top+".spdx.json"))
+	require.NoError(t, err)
+	require.Contains(t, string(spdx), "pkg:golang/vitess.io/vitess@")
+
+	if runtime.GOOS == "linux" && runtime.GOARCH == "amd64" {
+		extract := t.TempDir()
+		cmd := exec.Command("tar", "-xzf", tarballs[0], "-C", extract)
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+		output, err = exec.Command(filepath.Join(extract, top, "bin", "vtgate")).CombinedOutput()
+		require.NoError(t, err, string(output))
+		require.Equal(t, "12.0.4 "+commit+" v12.0.4\n", string(output))
+	}
+
+	// Mock builds only log the steps
+	opts.NoMock = false
+	mock := &mockBuildImplementation{}
+	sut := &Build{impl: mock, Options: opts}
+	_, err = sut.Binaries()
+	require.NoError(t, err)
+	// Worktree, compile and package for each platform and checksums
+	require.Len(t, mock.actions, 6)
+}
@@ -0,0 +1,117 @@
+package release
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/puerco/vtrelease/pkg/env"
+	"sigs.k8s.io/release-sdk/git"
+)
+
+type BranchImplementation interface {
+	CheckOptions(*BranchOptions) error
+	OpenRepository(*BranchOptions, *BranchState) error
+	SetEnvironment(*BranchOptions, *BranchState) error
+	CreateBranch(*BranchOptions, *BranchState) error
+	GenerateJavaVersions(*BranchOptions, string) error
+	WriteVersionFile(*BranchOptions, string) error
+	AddAndCommit(*BranchOptions, *BranchState, string) error
+}
+
+type BranchOptions struct {
+	// RepoPath is where the vitess repository is located
+	RepoPath string
+
+	// MainBranch is the branch the release branch is cut from
+	MainBranch string
+
+	// NoMock creates the release branch and commits the version bump of
+	// the main branch. Otherwise the branch point and versions are
+	// computed and the commits that would be made are logged.
+	NoMock bool
+}
+
+var DefaultBranchOptions = BranchOptions{
+	MainBranch: env.MainBranch,
+}
+
+func (o *BranchOptions) Validate() error {
+	if o.RepoPath == "" {
+		return errors.New("Path to repository not defined")
+	}
+	if o.MainBranch == "" {
+		return errors.New("main branch not defined")
+	}
+	return nil
+}
+
+type BranchState struct {
+	// Major version of the release branch
+	Major int
+
+	// Name of the release branch to create, eg release-14.0
+	ReleaseBranch string
+
+	// Development version main is bumped to, eg v15.0.0-SNAPSHOT
+	DevVersion string
+
+	// Commit in main where the release branch is cut
+	BranchPoint string
+
+	Repository *git.Repo
+}
+
+// Branch cuts a new major release branch from main
+type Branch struct {
+	Options BranchOptions
+	impl    BranchImplementation
+	State   BranchState
+}
+
+func NewBranch(o BranchOptions) *Branch {
+	var impl BranchImplementation = &mockBranchImplementation{}
+	if o.NoMock {
+		impl = &defaultBranchImplementation{}
+	}
+	return &Branch{
+		impl:    impl,
+		Options: o,
+	}
+}
+
+// Run cuts the release branch and bumps main to the next major version
+func (b *Branch) Run() error {
+	if err := b.impl.CheckOptions(&b.Options); err != nil {
+		return errors.Wrap(err, "checking branch options")
+	}
+
+	if err := b.impl.OpenRepository(&b.Options, &b.State); err != nil {
+		return errors.Wrap(err, "opening repository")
+	}
+
+	if err := b.impl.SetEnvironment(&b.Options, &b.State); err != nil {
+		return errors.Wrap(err, "setting up environment")
+	}
+
+	if err := b.impl.CreateBranch(&b.Options, &b.State); err != nil {
+		return errors.Wrapf(err, "creating branch %s", b.State.ReleaseBranch)
+	}
+
+	return errors.Wrap(b.BumpMain(), "bumping main to the next major version")
+}
+
+// BumpMain stamps the next major development version in main
+func (b *Branch) BumpMain() error {
+	if err := b.impl.GenerateJavaVersions(&b.Options, b.State.DevVersion); err != nil {
+		return errors.Wrapf(err, "generating version %s files in java source", b.State.DevVersion)
+	}
+
+	if err := b.impl.WriteVersionFile(&b.Options, b.State.DevVersion); err != nil {
+		return errors.Wrapf(err, "writing version %s to code", b.State.DevVersion)
+	}
+
+	return b.impl.AddAndCommit(
+		&b.Options, &b.State,
+		fmt.Sprintf("Bump %s to %s", b.Options.MainBranch, b.State.DevVersion),
+	)
+}
@@ -0,0 +1,97 @@
+package release
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/puerco/vtrelease/pkg/env"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/release-sdk/git"
+)
+
+type defaultBranchImplementation struct{}
+
+func (di *defaultBranchImplementation) CheckOptions(o *BranchOptions) error {
+	return o.Validate()
+}
+
+func (di *defaultBranchImplementation) OpenRepository(o *BranchOptions, s *BranchState) error {
+	repo, err := git.OpenRepo(o.RepoPath)
+	if err != nil {
+		return errors.Wrap(err, "opening repository")
+	}
+	logrus.Infof("Opened git repository in %s", o.RepoPath)
+	s.Repository = repo
+	return nil
+}
+
+// SetEnvironment checks out main and computes the release branch and
+// the development version from the tags in the repository
+func (di *defaultBranchImplementation) SetEnvironment(o *BranchOptions, s *BranchState) error {
+	logrus.Info("💻 Setting up the environment")
+	e := env.New().WithRepository(s.Repository)
+	e.Options.Branch = o.MainBranch
+
+	logrus.Infof("  > Checking out branch %s", o.MainBranch)
+	if err := e.CheckoutBranch(); err != nil {
+		return errors.Wrap(err, "checking out main branch")
+	}
+
+	// The new branch follows the highest major version tagged
+	major, err := e.HighestMajorVersion()
+	if err != nil {
+		return errors.Wrap(err, "getting version of the next release branch")
+	}
+	if major == 0 {
+		return errors.New("no version tags found to derive the release branch version")
+	}
+	major++
+	s.Major = major
+	s.ReleaseBranch = fmt.Sprintf("%s%d.0", env.BranchPrefix, major)
+	s.DevVersion = fmt.Sprintf("v%d.0.0-SNAPSHOT", major+1)
+
+	exists, err := s.Repository.HasBranch(s.ReleaseBranch)
+	if err != nil {
+		return errors.Wrapf(err, "checking if branch %s exists", s.ReleaseBranch)
+	}
+	if exists {
+		return errors.Errorf("branch %s already exists", s.ReleaseBranch)
+	}
+	logrus.Infof("  > Release branch will be: %s", s.ReleaseBranch)
+	logrus.Infof("  > %s will be bumped to: %s", o.MainBranch, s.DevVersion)
+
+	branchPoint, err := s.Repository.RevParse("HEAD")
+	if err != nil {
+		return errors.Wrap(err, "getting the current main commit")
+	}
+	logrus.Infof("  > Branch point: %s", branchPoint)
+	s.BranchPoint = branchPoint
+	return nil
+}
+
+// CreateBranch creates the release branch at the branch point
+func (di *defaultBranchImplementation) CreateBranch(o *BranchOptions, s *BranchState) error {
+	if _, err := s.Repository.Branch(s.ReleaseBranch, s.BranchPoint); err != nil {
+		return errors.Wrapf(err, "creating branch %s", s.ReleaseBranch)
+	}
+	logrus.Infof("🌿 Created branch %s at %s", s.ReleaseBranch, s.BranchPoint)
+	return nil
+}
+
+// GenerateJavaVersions patches the java sources with the version
+func (di *defaultBranchImplementation) GenerateJavaVersions(o *BranchOptions, tag string) error {
+	return setJavaVersion(o.RepoPath, tag)
+}
+
+// WriteVersionFile stamps the version into the version.go file
+func (di *defaultBranchImplementation) WriteVersionFile(o *BranchOptions, tag string) error {
+	return writeVersionFile(o.RepoPath, tag)
+}
+
+// AddAndCommit commits all modified files to main
+func (di *defaultBranchImplementation) AddAndCommit(o *BranchOptions, s *BranchState, message string) error {
+	if err := s.Repository.Add("--all"); err != nil {
+		return errors.Wrap(err, "adding modified files to commit")
+	}
+	return errors.Wrap(s.Repository.UserCommit(message), "creating commit")
+}
@@ -0,0 +1,32 @@
+package release
+
+// mockBranchImplementation computes the new branch from the repository
+// but only logs the steps that would modify it
+type mockBranchImplementation struct {
+	defaultBranchImplementation
+	mockRecorder
+}
+
+// CreateBranch logs the branch that would be created
+func (mi *mockBranchImplementation) CreateBranch(o *BranchOptions, s *BranchState) error {
+	mi.record("create branch %s at %s", s.ReleaseBranch, s.BranchPoint)
+	return nil
+}
+
+// GenerateJavaVersions logs the version the java modules would be set to
+func (mi *mockBranchImplementation) GenerateJavaVersions(o *BranchOptions, tag string) error {
+	mi.record("set the java modules to version %s", javaVersion(tag))
+	return nil
+}
+
+// WriteVersionFile logs the version that would be stamped in version.go
+func (mi *mockBranchImplementation) WriteVersionFile(o *BranchOptions, tag string) error {
+	mi.record("write version %s to %s", tag, versionFile)
+	return nil
+}
+
+// AddAndCommit logs the commit that would be created
+func (mi *mockBranchImplementation) AddAndCommit(o *BranchOptions, s *BranchState, message string) error {
+	mi.record("commit all changes with message %q", message)
+	return nil
+}
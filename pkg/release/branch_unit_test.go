@@ -0,0 +1,38 @@
+package release
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockBranch(t *testing.T) {
+	repo := newTestRepo(t)
+	runGit(t, repo.Dir(), "tag", "v12.0.3")
+	runGit(t, repo.Dir(), "tag", "v13.0.0-rc1")
+	runGit(t, repo.Dir(), "branch", "main")
+	head := strings.TrimSpace(runGit(t, repo.Dir(), "rev-parse", "HEAD"))
+
+	mock := &mockBranchImplementation{}
+	sut := &Branch{
+		impl:    mock,
+		Options: BranchOptions{RepoPath: repo.Dir(), MainBranch: "main"},
+	}
+	require.NoError(t, sut.Run())
+	require.Equal(t, "release-14.0", sut.State.ReleaseBranch)
+	require.Equal(t, []string{
+		"create branch release-14.0 at " + head,
+		"set the java modules to version 15.0.0-SNAPSHOT",
+		"write version v15.0.0-SNAPSHOT to " + versionFile,
+		`commit all changes with message "Bump main to v15.0.0-SNAPSHOT"`,
+	}, mock.actions)
+
+	// Cutting a branch that exists should fail
+	runGit(t, repo.Dir(), "branch", "release-14.0")
+	sut = &Branch{
+		impl:    &mockBranchImplementation{},
+		Options: BranchOptions{RepoPath: repo.Dir(), MainBranch: "main"},
+	}
+	require.Error(t, sut.Run())
+}
@@ -1,16 +1,35 @@
 package release
 
-import "github.com/pkg/errors"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/release-utils/util"
+)
 
 type Build struct {
 	Options BuildOptions
 	impl    BuildImplementation
 	State   State
+
+	// mtx guards the images recorded in the state by concurrent builds
+	mtx sync.Mutex
 }
 
 func NewBuild(o BuildOptions) *Build {
+	var impl BuildImplementation = &mockBuildImplementation{}
+	if o.NoMock {
+		impl = &defaultBuildImplementation{}
+	}
 	return &Build{
-		impl:    &defaultBuildImplementation{},
+		impl:    impl,
 		Options: o,
 		State:   State{},
 	}
@@ -26,15 +45,149 @@ type BuildOptions struct {
 
 	// Registry where images are staged
 	StagingRegistry string
+
+	// Platforms to build the images for, eg linux/amd64
+	Platforms []string
+
+	// Jobs is the maximum number of images built concurrently
+	Jobs int
+
+	// Builder is the container build backend: buildx, podman, buildah
+	// or daemonless
+	Builder string
+
+	// ArtifactsDir is the directory where release artifacts like the
+	// SBOMs are written
+	ArtifactsDir string
+
+	// SourceRepository is the URL of the vitess repository recorded in
+	// the provenance of the images
+	SourceRepository string
+
+	// SigningKey is the PEM encoded private key used to sign the
+	// provenance attestations. It is required to build images for real,
+	// in mock mode images are not attested without it.
+	SigningKey string
+
+	// Branch that was staged, the build reads the version and the
+	// release commit from the state the stage recorded for it
+	Branch string
+
+	// StateFile is the file where the stage recorded its state. If
+	// empty and Branch is set, the default for the branch is used.
+	StateFile string
+
+	// NoMock builds and pushes the images, their SBOMs and attestations
+	// to the staging registry. In mock mode the options are validated
+	// and the builder commands are printed instead of run.
+	NoMock bool
 }
 
 var DefaultBuildOptions = BuildOptions{
 	DebianVersions:       []string{"buster", "bullseye"},
 	DefaultDebianVersion: "buster",
 	StagingRegistry:      "gcr.io/puerco-chainguard/vitess/staging",
+	Platforms:            []string{"linux/amd64", "linux/arm64"},
+	Jobs:                 4,
+	Builder:              BuilderBuildx,
+	ArtifactsDir:         "artifacts",
+	SourceRepository:     "https://github.com/vitessio/vitess",
+}
+
+// KnownDebianVersions are the debian releases images can be based on
+var KnownDebianVersions = []string{"stretch", "buster", "bullseye", "bookworm"}
+
+// StatePath returns the path to the state file written by the stage
+func (o *BuildOptions) StatePath() string {
+	return statePath(o.StateFile, o.Branch)
 }
 
 func (o *BuildOptions) Validate() error {
+	return validationError("invalid build options", o.validate())
+}
+
+// validate checks the options and returns a list of all problems found
+func (o *BuildOptions) validate() []string {
+	problems := []string{}
+	if o.RepoPath == "" {
+		problems = append(problems, "path to repository not defined")
+	}
+
+	if o.VTBaseVersion == "" {
+		problems = append(problems, "version to build not defined")
+	} else if _, err := semver.Parse(strings.TrimPrefix(o.VTBaseVersion, "v")); err != nil {
+		problems = append(problems, fmt.Sprintf("version %q is not a valid semantic version", o.VTBaseVersion))
+	}
+
+	if len(o.DebianVersions) == 0 {
+		problems = append(problems, "no debian versions defined")
+	}
+	for _, distro := range o.DebianVersions {
+		if !stringInSlice(distro, KnownDebianVersions) {
+			problems = append(problems, fmt.Sprintf(
+				"unknown debian version %q, must be one of %s", distro, strings.Join(KnownDebianVersions, ", "),
+			))
+		}
+	}
+	if !stringInSlice(o.DefaultDebianVersion, o.DebianVersions) {
+		problems = append(problems, fmt.Sprintf(
+			"default debian version %q is not one of the versions to build", o.DefaultDebianVersion,
+		))
+	}
+
+	if _, err := name.NewRepository(o.StagingRegistry, name.StrictValidation); err != nil {
+		problems = append(problems, fmt.Sprintf("invalid staging registry %q: %v", o.StagingRegistry, err))
+	}
+
+	if len(o.Platforms) == 0 {
+		problems = append(problems, "no platforms defined to build the images")
+	}
+
+	if _, err := newImageBuilder(o.Builder); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if o.SigningKey != "" && !util.Exists(o.SigningKey) {
+		problems = append(problems, fmt.Sprintf("signing key %s not found", o.SigningKey))
+	}
+	return problems
+}
+
+// validationError returns an error listing all problems or nil if
+// there are none
+func validationError(msg string, problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.Errorf("%s:\n  - %s", msg, strings.Join(problems, "\n  - "))
+}
+
+// stringInSlice returns true if s is in list
+func stringInSlice(s string, list []string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadState reads the state of the staged release when a branch or a
+// state file is set. The build then uses the staged version and release
+// commit.
+func (b *Build) LoadState() error {
+	if b.Options.Branch == "" && b.Options.StateFile == "" {
+		return nil
+	}
+	if err := b.impl.LoadState(&b.Options, &b.State); err != nil {
+		return errors.Wrap(err, "loading stage state")
+	}
+	if b.Options.NoMock && !b.State.NoMock {
+		return errors.New("refusing to build a release that was staged in mock mode")
+	}
+	if !b.State.StepDone(stepTagRepository) {
+		return errors.Errorf("staging of %s did not finish", b.State.Version)
+	}
 	return nil
 }
 
@@ -42,6 +195,208 @@ func (b *Build) Image(image string) error {
 	if err := b.impl.ValidateImageOpts(&b.Options, &b.State, image); err != nil {
 		return errors.Wrap(err, "validating image build options")
 	}
-	return b.impl.BuildImage(&b.Options, &b.State, image)
+	started := time.Now()
+	if err := b.impl.BuildImage(&b.Options, &b.State, image); err != nil {
+		return errors.Wrap(err, "building image")
+	}
+	if err := b.impl.VerifyImagePlatforms(&b.Options, &b.State, image); err != nil {
+		return errors.Wrap(err, "verifying image platforms")
+	}
+	finished := time.Now()
+	digests, err := b.impl.ImageDigests(&b.Options, &b.State, image)
+	if err != nil {
+		return errors.Wrap(err, "reading image digests")
+	}
+	if err := b.recordImages(digests); err != nil {
+		return errors.Wrap(err, "recording image digests")
+	}
+	if err := b.impl.GenerateSBOMs(&b.Options, &b.State, image); err != nil {
+		return errors.Wrap(err, "generating image SBOMs")
+	}
+	return errors.Wrap(
+		b.impl.AttestImage(&b.Options, &b.State, image, started, finished),
+		"attesting image provenance",
+	)
+}
+
+// recordImages adds the pushed image variants to the state, replacing
+// earlier records of the same variants, and writes the release manifest
+func (b *Build) recordImages(digests []ImageDigest) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.State.Images = mergeImages(b.State.Images, digests)
+	return b.impl.WriteReleaseManifest(&b.Options, &b.State)
+}
+
+// mergeImages returns the image variants in recorded replaced or
+// completed by those in updates, sorted by image and debian version
+func mergeImages(recorded, updates []ImageDigest) []ImageDigest {
+	images := []ImageDigest{}
+	for _, r := range recorded {
+		replaced := false
+		for _, d := range updates {
+			if r.Image == d.Image && r.Distro == d.Distro {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			images = append(images, r)
+		}
+	}
+	images = append(images, updates...)
+	sort.Slice(images, func(i, j int) bool {
+		if images[i].Image != images[j].Image {
+			return images[i].Image < images[j].Image
+		}
+		return images[i].Distro < images[j].Distro
+	})
+	return images
+}
+
+// ImageResult is the outcome of building one image
+type ImageResult struct {
+	Image string
+	Error error
+
+	// Skipped is set when the image was not built because one of its
+	// dependencies failed
+	Skipped bool
+}
+
+// AllImages builds every image found in the repository
+func (b *Build) AllImages() ([]ImageResult, error) {
+	images, err := b.impl.DiscoverImages(&b.Options)
+	if err != nil {
+		return nil, errors.Wrap(err, "discovering images")
+	}
+	logrus.Infof("Found %d images to build: %v", len(images), images)
+	return b.Images(images)
+}
+
+// Images builds a list of images. Images are built after the images
+// in the list they depend on and independent builds run concurrently.
+// A failed build does not stop the rest, only the images depending on
+// it are skipped. Returns the result of every image.
+func (b *Build) Images(images []string) ([]ImageResult, error) {
+	deps, err := b.dependencyGraph(images)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := b.Options.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	sem := make(chan struct{}, jobs)
+	done := map[string]chan struct{}{}
+	results := make([]ImageResult, len(images))
+	index := map[string]int{}
+	for i, image := range images {
+		done[image] = make(chan struct{})
+		index[image] = i
+	}
+
+	var wg sync.WaitGroup
+	for i, image := range images {
+		wg.Add(1)
+		go func(i int, image string) {
+			defer wg.Done()
+			defer close(done[image])
+			results[i].Image = image
+
+			for _, dep := range deps[image] {
+				<-done[dep]
+				if results[index[dep]].Error != nil {
+					results[i].Skipped = true
+					results[i].Error = errors.Errorf("dependency %s failed", dep)
+					return
+				}
+			}
 
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			logrus.Infof("🔨 Building image %s", image)
+			results[i].Error = b.Image(image)
+		}(i, image)
+	}
+	wg.Wait()
+
+	return results, reportImageResults(results)
+}
+
+// dependencyGraph maps each image to the images in the list it depends
+// on, failing if there is a dependency cycle
+func (b *Build) dependencyGraph(images []string) (map[string][]string, error) {
+	inList := map[string]bool{}
+	for _, image := range images {
+		if inList[image] {
+			return nil, errors.Errorf("image %s listed more than once", image)
+		}
+		inList[image] = true
+	}
+
+	graph := map[string][]string{}
+	for _, image := range images {
+		deps, err := b.impl.ImageDependencies(&b.Options, image)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading dependencies of %s", image)
+		}
+		for _, dep := range deps {
+			if inList[dep] {
+				graph[image] = append(graph[image], dep)
+			}
+		}
+	}
+
+	// Check for cycles with a depth first search
+	const visiting, visited = 1, 2
+	marks := map[string]int{}
+	var visit func(string) error
+	visit = func(image string) error {
+		switch marks[image] {
+		case visiting:
+			return errors.Errorf("dependency cycle involving image %s", image)
+		case visited:
+			return nil
+		}
+		marks[image] = visiting
+		for _, dep := range graph[image] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		marks[image] = visited
+		return nil
+	}
+	for _, image := range images {
+		if err := visit(image); err != nil {
+			return nil, err
+		}
+	}
+	return graph, nil
+}
+
+// reportImageResults logs a summary of the builds and returns an error
+// if any of them failed
+func reportImageResults(results []ImageResult) error {
+	failed := 0
+	logrus.Info("📦 Image build summary:")
+	for _, r := range results {
+		switch {
+		case r.Skipped:
+			failed++
+			logrus.Errorf("  ⏭️  %s: skipped, %v", r.Image, r.Error)
+		case r.Error != nil:
+			failed++
+			logrus.Errorf("  ❌ %s: %v", r.Image, r.Error)
+		default:
+			logrus.Infof("  ✅ %s", r.Image)
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("%d of %d images failed to build", failed, len(results))
+	}
+	return nil
 }
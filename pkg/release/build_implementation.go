@@ -1,44 +1,887 @@
 package release
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/blang/semver"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/release-sdk/git"
 	"sigs.k8s.io/release-utils/command"
+	"sigs.k8s.io/release-utils/util"
 )
 
 type BuildImplementation interface {
 	BuildImage(*BuildOptions, *State, string) error
 	ValidateImageOpts(*BuildOptions, *State, string) error
+	VerifyImagePlatforms(*BuildOptions, *State, string) error
+	GenerateSBOMs(*BuildOptions, *State, string) error
+	AttestImage(*BuildOptions, *State, string, time.Time, time.Time) error
+	ImageDigests(*BuildOptions, *State, string) ([]ImageDigest, error)
+	WriteReleaseManifest(*BuildOptions, *State) error
+	LoadState(*BuildOptions, *State) error
+	ValidateBinariesOpts(*BuildOptions, *State) error
+	SourceCommit(*BuildOptions, *State) (string, error)
+	CheckoutSource(*BuildOptions, *State) (string, string, error)
+	RemoveSource(*BuildOptions, string) error
+	CompileBinaries(*BuildOptions, *State, string, string, string) (string, error)
+	PackageBinaries(*BuildOptions, *State, string, string, string) (string, error)
+	WriteChecksums(*BuildOptions, string, []string) error
+	ExtractBinaries(*BuildOptions, *State, string, string) (string, error)
+	BuildPackage(*BuildOptions, *State, string, string, string, string) (string, error)
+	ImageTags(*BuildOptions, *State, string) ([]string, error)
+	DiscoverImages(*BuildOptions) ([]string, error)
+	ImageDependencies(*BuildOptions, string) ([]string, error)
 }
 
 type defaultBuildImplementation struct {
 }
 
-func (di *defaultBuildImplementation) ValidateImageOpts(o *BuildOptions, s *State, name string) error {
-	return nil
+// ValidateImageOpts checks the build options and that the image and the
+// version to build exist in the repository. All problems found are
+// reported together.
+func (di *defaultBuildImplementation) ValidateImageOpts(o *BuildOptions, s *State, imageName string) error {
+	problems := o.validate()
+	if o.RepoPath == "" {
+		return validationError("invalid build options", problems)
+	}
+
+	// Released images must ship with their provenance
+	if o.NoMock && o.SigningKey == "" {
+		problems = append(problems, "a signing key is required to attest the images")
+	}
+
+	// Validate the image name by checking a dir in docker/k8s/${name}
+	if _, err := imageBuildSpec(o.RepoPath, imageName); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if o.VTBaseVersion != "" {
+		repo, err := git.OpenRepo(o.RepoPath)
+		if err != nil {
+			return errors.Wrap(err, "opening repository")
+		}
+		tags, err := repo.Tags()
+		if err != nil {
+			return errors.Wrap(err, "listing repository tags")
+		}
+		if !stringInSlice(o.VTBaseVersion, tags) {
+			problems = append(problems, fmt.Sprintf("version %s is not tagged in the repository", o.VTBaseVersion))
+		} else {
+			treeProblems, err := di.sourceTreeProblems(o, s, repo)
+			if err != nil {
+				return err
+			}
+			problems = append(problems, treeProblems...)
+		}
+	}
+	return validationError(fmt.Sprintf("invalid options to build image %s", imageName), problems)
+}
+
+// sourceTreeProblems checks that the images will be built from the
+// commit of the release, as recorded in their provenance: the checkout
+// must be at the commit and have no local changes.
+func (di *defaultBuildImplementation) sourceTreeProblems(o *BuildOptions, s *State, repo *git.Repo) ([]string, error) {
+	commit, err := di.SourceCommit(o, s)
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.RevParse("HEAD")
+	if err != nil {
+		return nil, errors.Wrap(err, "getting repository HEAD")
+	}
+	problems := []string{}
+	if head != commit {
+		problems = append(problems, fmt.Sprintf(
+			"repository is at %s but %s was released from %s", head, o.VTBaseVersion, commit,
+		))
+	}
+	status, err := command.NewWithWorkDir(
+		o.RepoPath, "git", "status", "--porcelain",
+	).RunSilentSuccessOutput()
+	if err != nil {
+		return nil, errors.Wrap(err, "checking repository status")
+	}
+	if status.OutputTrimNL() != "" {
+		problems = append(problems, "repository has uncommitted changes")
+	}
+	return problems, nil
 }
 
 func (di *defaultBuildImplementation) BuildImage(o *BuildOptions, s *State, imageName string) error {
-	// echo "####### Building vitess/vt:$debian_version"
+	builder, err := newImageBuilder(o.Builder)
+	if err != nil {
+		return err
+	}
+	if err := builder.CheckTools(); err != nil {
+		return errors.Wrapf(err, "checking %s builder tools", o.Builder)
+	}
 
-	// Validate the image name by checking a dir in docker/k8s/${name}
+	for _, distro := range o.DebianVersions {
+		logrus.Infof("####### Building %s for debian %s with %s", imageName, distro, o.Builder)
+		req, err := di.buildRequest(o, s, imageName, distro)
+		if err != nil {
+			return errors.Wrapf(err, "preparing build of %s", imageName)
+		}
+		for _, cmd := range builder.Commands(req) {
+			if cmd.MayFail {
+				if err := command.NewWithWorkDir(
+					cmd.WorkDir, cmd.Name, cmd.Args...,
+				).RunSilentSuccess(); err != nil {
+					logrus.Debugf("Ignoring failure of %s %s: %v", cmd.Name, strings.Join(cmd.Args, " "), err)
+				}
+				continue
+			}
+			if err := command.NewWithWorkDir(
+				cmd.WorkDir, cmd.Name, cmd.Args...,
+			).RunSuccess(); err != nil {
+				return errors.Wrapf(err, "running %s", cmd.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// buildRequest assembles everything needed to build the variant of an
+// image for a debian version
+func (di *defaultBuildImplementation) buildRequest(
+	o *BuildOptions, s *State, imageName, distro string,
+) (*imageBuildRequest, error) {
+	spec, err := imageBuildSpec(o.RepoPath, imageName)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := di.ImageTags(o, s, distro)
+	if err != nil {
+		return nil, errors.Wrap(err, "computing image tags")
+	}
+
+	deps, err := di.ImageDependencies(o, imageName)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading image dependencies")
+	}
+
+	req := &imageBuildRequest{
+		imageSpec: *spec,
+		Name:      imageName,
+		Distro:    distro,
+		Platforms: o.Platforms,
+		BuildArgs: []string{
+			fmt.Sprintf("VT_BASE_VER=%s", o.VTBaseVersion),
+			fmt.Sprintf("DEBIAN_VER=%s-slim", distro),
+		},
+		BaseImages: map[string]string{},
+	}
+	for _, tag := range tags {
+		req.Tags = append(req.Tags, fmt.Sprintf("%s/%s:%s", o.StagingRegistry, imageName, tag))
+	}
+
+	// Images built in the release replace their upstream references
+	for _, dep := range deps {
+		req.BaseImages[fmt.Sprintf("vitess/%s:%s", dep, o.VTBaseVersion)] = fmt.Sprintf(
+			"%s/%s:%s-%s", o.StagingRegistry, dep, o.VTBaseVersion, distro,
+		)
+	}
+	return req, nil
+}
+
+// DiscoverImages returns the images under docker/k8s and the images
+// from the repository they depend on
+func (di *defaultBuildImplementation) DiscoverImages(o *BuildOptions) ([]string, error) {
+	k8sDir := filepath.Join(o.RepoPath, k8sImagesDir)
+	entries, err := os.ReadDir(k8sDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", k8sDir)
+	}
+
+	images := []string{}
+	if util.Exists(filepath.Join(k8sDir, "Dockerfile")) {
+		images = append(images, k8sBaseImage)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && util.Exists(filepath.Join(k8sDir, entry.Name(), "Dockerfile")) {
+			images = append(images, entry.Name())
+		}
+	}
+
+	// Add the dependencies of the images found
+	seen := map[string]bool{}
+	for _, image := range images {
+		seen[image] = true
+	}
+	for i := 0; i < len(images); i++ {
+		deps, err := di.ImageDependencies(o, images[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading dependencies of %s", images[i])
+		}
+		for _, dep := range deps {
+			if !seen[dep] {
+				seen[dep] = true
+				images = append(images, dep)
+			}
+		}
+	}
+	sort.Strings(images)
+	return images, nil
+}
+
+// ImageDependencies returns the vitess images an image is built from
+// that can be built from the repository
+func (di *defaultBuildImplementation) ImageDependencies(o *BuildOptions, imageName string) ([]string, error) {
+	spec, err := imageBuildSpec(o.RepoPath, imageName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(spec.WorkDir, spec.Dockerfile))
+	if err != nil {
+		return nil, errors.Wrap(err, "reading Dockerfile")
+	}
 
-	// TODO(puerco): Only push second tag when default debian version
+	deps := []string{}
+	seen := map[string]bool{imageName: true}
+	for _, match := range fromVitessImage.FindAllStringSubmatch(string(data), -1) {
+		dep := match[1]
+		if seen[dep] {
+			continue
+		}
+		seen[dep] = true
+		if _, err := imageBuildSpec(o.RepoPath, dep); err != nil {
+			logrus.Debugf("Image %s depends on %s which is not built from the repo", imageName, dep)
+			continue
+		}
+		deps = append(deps, dep)
+	}
+	return deps, nil
+}
+
+// ImageTags returns the tags to apply to the image built for a debian
+// version, based on the version tags in the repository
+func (di *defaultBuildImplementation) ImageTags(o *BuildOptions, s *State, distro string) ([]string, error) {
+	repo, err := git.OpenRepo(o.RepoPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening repository")
+	}
+	repoTags, err := repo.Tags()
+	if err != nil {
+		return nil, errors.Wrap(err, "listing repository tags")
+	}
+	return imageTags(o.VTBaseVersion, distro, o.DefaultDebianVersion, repoTags)
+}
+
+// imageTags computes the tag plan for an image variant. Every variant
+// is tagged VERSION-DISTRO and the default debian version also gets the
+// bare VERSION tag. If the version is the newest release of its minor
+// line, its major line or of all, the floating MAJOR.MINOR, MAJOR and
+// latest tags are added. Floating tags of variants other than the
+// default are suffixed with the distro too.
+func imageTags(version, distro, defaultDistro string, repoTags []string) ([]string, error) {
+	ver, err := semver.Parse(strings.TrimPrefix(version, "v"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing version %s", version)
+	}
+	prefix := ""
+	if strings.HasPrefix(version, "v") {
+		prefix = "v"
+	}
+
+	suffix := "-" + distro
+	tags := []string{version + suffix}
+	if distro == defaultDistro {
+		suffix = ""
+		tags = append(tags, version)
+	}
+
+	// Pre-releases never move the floating tags
+	if len(ver.Pre) > 0 {
+		return tags, nil
+	}
+
+	newestMinor, newestMajor, newest := true, true, true
+	for _, tag := range repoTags {
+		if !strings.HasPrefix(tag, "v") {
+			continue
+		}
+		other, err := semver.Parse(tag[1:])
+		if err != nil || len(other.Pre) > 0 || !other.GT(ver) {
+			continue
+		}
+		newest = false
+		if other.Major == ver.Major {
+			newestMajor = false
+			if other.Minor == ver.Minor {
+				newestMinor = false
+			}
+		}
+	}
+
+	if newestMinor {
+		tags = append(tags, fmt.Sprintf("%s%d.%d%s", prefix, ver.Major, ver.Minor, suffix))
+	}
+	if newestMajor {
+		tags = append(tags, fmt.Sprintf("%s%d%s", prefix, ver.Major, suffix))
+	}
+	if newest {
+		tags = append(tags, "latest"+suffix)
+	}
+	return tags, nil
+}
+
+// VerifyImagePlatforms checks that the images pushed for every debian
+// variant contain all the platforms requested in the options
+func (di *defaultBuildImplementation) VerifyImagePlatforms(o *BuildOptions, s *State, imageName string) error {
+	for _, distro := range o.DebianVersions {
+		ref := fmt.Sprintf("%s/%s:%s-%s", o.StagingRegistry, imageName, o.VTBaseVersion, distro)
+		platforms, err := imagePlatforms(ref)
+		if err != nil {
+			return errors.Wrapf(err, "reading platforms of %s", ref)
+		}
+		available := map[string]bool{}
+		for platform := range platforms {
+			available[normalizePlatform(platform)] = true
+		}
+		missing := []string{}
+		for _, platform := range o.Platforms {
+			if !available[normalizePlatform(platform)] {
+				missing = append(missing, platform)
+			}
+		}
+		if len(missing) > 0 {
+			return errors.Errorf(
+				"image %s is missing platforms: %s", ref, strings.Join(missing, ", "),
+			)
+		}
+		logrus.Infof("✅ Image %s has all platforms: %s", ref, strings.Join(o.Platforms, ", "))
+	}
+	return nil
+}
+
+// ImageDigests reads the digests of the pushed variants of an image and
+// their platform images. It fails if any of the tags of a variant does
+// not point to the same digest.
+func (di *defaultBuildImplementation) ImageDigests(o *BuildOptions, s *State, imageName string) ([]ImageDigest, error) {
+	auth := remote.WithAuthFromKeychain(authn.DefaultKeychain)
+	digests := []ImageDigest{}
 	for _, distro := range o.DebianVersions {
-		err := command.NewWithWorkDir(
-			filepath.Join(o.RepoPath, "docker/k8s"),
-			"docker", "buildx", "build",
-			"--build-arg", fmt.Sprintf("VT_BASE_VER=%s", o.VTBaseVersion),
-			"--build-arg", fmt.Sprintf("DEBIAN_VER=%s-slim", distro),
-			"--tag", fmt.Sprintf("%s/%s:%s-%s", o.StagingRegistry, imageName, o.VTBaseVersion, distro),
-			"--tag", fmt.Sprintf("%s/%s:%s", o.StagingRegistry, imageName, o.VTBaseVersion),
-			"--output", "type=image,push=true",
-			imageName,
-		).RunSuccess()
+		req, err := di.buildRequest(o, s, imageName, distro)
+		if err != nil {
+			return nil, errors.Wrapf(err, "preparing build of %s", imageName)
+		}
+		ref, err := name.ParseReference(
+			fmt.Sprintf("%s/%s:%s-%s", o.StagingRegistry, imageName, o.VTBaseVersion, distro),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing image reference")
+		}
+		desc, err := remote.Get(ref, auth)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetching %s", ref)
+		}
+
+		record := ImageDigest{
+			Image:      imageName,
+			Distro:     distro,
+			Repository: ref.Context().Name(),
+			Digest:     desc.Digest.String(),
+			Tags:       []string{},
+			Platforms:  map[string]string{},
+		}
+
+		if desc.MediaType.IsIndex() {
+			idx, err := desc.ImageIndex()
+			if err != nil {
+				return nil, errors.Wrapf(err, "reading index of %s", ref)
+			}
+			manifest, err := idx.IndexManifest()
+			if err != nil {
+				return nil, errors.Wrapf(err, "reading index of %s", ref)
+			}
+			for _, m := range manifest.Manifests {
+				if m.Platform == nil || m.Platform.OS == "unknown" {
+					continue
+				}
+				platform := platformString(m.Platform.OS, m.Platform.Architecture, m.Platform.Variant)
+				record.Platforms[platform] = m.Digest.String()
+			}
+		} else {
+			img, err := desc.Image()
+			if err != nil {
+				return nil, errors.Wrapf(err, "reading image %s", ref)
+			}
+			platform, err := imageConfigPlatform(img)
+			if err != nil {
+				return nil, errors.Wrapf(err, "reading platform of %s", ref)
+			}
+			record.Platforms[platform] = desc.Digest.String()
+		}
+
+		for _, tagRef := range req.Tags {
+			tag, err := name.NewTag(tagRef)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parsing tag %s", tagRef)
+			}
+			tagDesc, err := remote.Head(tag, auth)
+			if err != nil {
+				return nil, errors.Wrapf(err, "fetching digest of %s", tag)
+			}
+			if tagDesc.Digest != desc.Digest {
+				return nil, errors.Errorf(
+					"%s points to %s, expected %s", tag, tagDesc.Digest, desc.Digest,
+				)
+			}
+			record.Tags = append(record.Tags, tag.TagStr())
+		}
+		logrus.Infof("📌 %s@%s tagged %s", record.Repository, record.Digest, strings.Join(record.Tags, ", "))
+		digests = append(digests, record)
+	}
+	return digests, nil
+}
+
+// WriteReleaseManifest writes the images recorded in the state to the
+// release manifest in the artifacts directory. Images already in the
+// manifest from earlier runs are kept unless they were built again.
+func (di *defaultBuildImplementation) WriteReleaseManifest(o *BuildOptions, s *State) error {
+	if err := os.MkdirAll(o.ArtifactsDir, os.FileMode(0o755)); err != nil {
+		return errors.Wrap(err, "creating artifacts directory")
+	}
+	path := filepath.Join(o.ArtifactsDir, releaseManifestFile)
+	manifest := ReleaseManifest{Version: o.VTBaseVersion}
+	if util.Exists(path) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "reading %s", path)
+		}
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return errors.Wrapf(err, "parsing %s", path)
+		}
+		if manifest.Version != o.VTBaseVersion {
+			return errors.Errorf(
+				"release manifest %s is for version %s, not %s", path, manifest.Version, o.VTBaseVersion,
+			)
+		}
+	}
+	manifest.Images = mergeImages(manifest.Images, s.Images)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshaling release manifest")
+	}
+	return errors.Wrapf(os.WriteFile(path, data, os.FileMode(0o644)), "writing %s", path)
+}
+
+// GenerateSBOMs writes SPDX and CycloneDX documents for every platform
+// image of each debian variant to the artifacts directory and attaches
+// them to the image digests in the registry
+func (di *defaultBuildImplementation) GenerateSBOMs(o *BuildOptions, s *State, imageName string) error {
+	sbomDir := filepath.Join(o.ArtifactsDir, "sbom")
+	if err := os.MkdirAll(sbomDir, os.FileMode(0o755)); err != nil {
+		return errors.Wrap(err, "creating sbom directory")
+	}
+	for _, distro := range o.DebianVersions {
+		ref, err := name.ParseReference(
+			fmt.Sprintf("%s/%s:%s-%s", o.StagingRegistry, imageName, o.VTBaseVersion, distro),
+		)
+		if err != nil {
+			return errors.Wrap(err, "parsing image reference")
+		}
+		images, err := platformImages(ref)
 		if err != nil {
 			return err
 		}
+		for _, pi := range images {
+			platform := pi.Platform
+			doc, err := imageSBOM(pi.Image, imageName, o.VTBaseVersion, distro)
+			if err != nil {
+				return errors.Wrapf(err, "inventorying %s %s", ref, platform)
+			}
+			digest := ref.Context().Digest(pi.Digest.String())
+			tag, err := attachedTag(digest, sbomTagSuffix)
+			if err != nil {
+				return errors.Wrap(err, "computing sbom tag")
+			}
+			baseName := fmt.Sprintf(
+				"%s-%s-%s-%s", imageName, o.VTBaseVersion, distro, strings.ReplaceAll(platform, "/", "-"),
+			)
+			for _, format := range []struct {
+				ext       string
+				mediaType types.MediaType
+				render    func() ([]byte, error)
+			}{
+				{"spdx.json", spdxMediaType, doc.SPDX},
+				{"cdx.json", cycloneDXMediaType, doc.CycloneDX},
+			} {
+				data, err := format.render()
+				if err != nil {
+					return err
+				}
+				path := filepath.Join(sbomDir, fmt.Sprintf("%s.%s", baseName, format.ext))
+				if err := os.WriteFile(path, data, os.FileMode(0o644)); err != nil {
+					return errors.Wrapf(err, "writing %s", path)
+				}
+				if err := attachLayer(
+					tag, static.NewLayer(data, format.mediaType), nil, withMediaType(format.mediaType),
+				); err != nil {
+					return errors.Wrapf(err, "attaching sbom to %s", digest)
+				}
+			}
+			logrus.Infof("📦 SBOMs for %s %s with %d packages attached to %s", ref, platform, len(doc.Packages), tag)
+		}
+	}
+	return nil
+}
+
+// AttestImage signs a SLSA provenance statement for each debian variant
+// of the image, linking its digest to the commit of the release tag. The
+// attestations are attached to the image in the registry and written to
+// the artifacts directory.
+func (di *defaultBuildImplementation) AttestImage(
+	o *BuildOptions, s *State, imageName string, started, finished time.Time,
+) error {
+	if o.SigningKey == "" {
+		return errors.New("a signing key is required to attest the images")
+	}
+	key, err := LoadPrivateKey(o.SigningKey)
+	if err != nil {
+		return errors.Wrap(err, "loading signing key")
+	}
+	commit, err := di.SourceCommit(o, s)
+	if err != nil {
+		return err
+	}
+
+	provenanceDir := filepath.Join(o.ArtifactsDir, "provenance")
+	if err := os.MkdirAll(provenanceDir, os.FileMode(0o755)); err != nil {
+		return errors.Wrap(err, "creating provenance directory")
+	}
+	for _, distro := range o.DebianVersions {
+		req, err := di.buildRequest(o, s, imageName, distro)
+		if err != nil {
+			return errors.Wrapf(err, "preparing provenance of %s", imageName)
+		}
+		ref, err := name.ParseReference(
+			fmt.Sprintf("%s/%s:%s-%s", o.StagingRegistry, imageName, o.VTBaseVersion, distro),
+		)
+		if err != nil {
+			return errors.Wrap(err, "parsing image reference")
+		}
+		desc, err := remote.Head(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+		if err != nil {
+			return errors.Wrapf(err, "fetching digest of %s", ref)
+		}
+
+		dockerfile, err := filepath.Rel(o.RepoPath, filepath.Join(req.WorkDir, req.Dockerfile))
+		if err != nil {
+			return errors.Wrap(err, "locating dockerfile")
+		}
+
+		p := provenance{
+			SourceRepository: o.SourceRepository,
+			Tag:              o.VTBaseVersion,
+			Commit:           commit,
+			Dockerfile:       filepath.ToSlash(dockerfile),
+			BuilderID:        fmt.Sprintf("https://github.com/puerco/vtrelease/builders/%s", o.Builder),
+			BuildArgs:        map[string]string{"platforms": strings.Join(req.Platforms, ",")},
+			StartedOn:        started,
+			FinishedOn:       finished,
+			Subjects:         map[string]string{ref.Context().Name(): desc.Digest.Hex},
+		}
+		for _, arg := range req.BuildArgs {
+			parts := strings.SplitN(arg, "=", 2)
+			p.BuildArgs[parts[0]] = parts[len(parts)-1]
+		}
+
+		envelope, err := signStatement(key, p.Statement())
+		if err != nil {
+			return errors.Wrap(err, "signing provenance")
+		}
+		path := filepath.Join(
+			provenanceDir, fmt.Sprintf("%s-%s-%s.intoto.json", imageName, o.VTBaseVersion, distro),
+		)
+		if err := os.WriteFile(path, envelope, os.FileMode(0o644)); err != nil {
+			return errors.Wrapf(err, "writing %s", path)
+		}
+
+		digest := ref.Context().Digest(desc.Digest.String())
+		tag, err := attachedTag(digest, attestationTagSuffix)
+		if err != nil {
+			return errors.Wrap(err, "computing attestation tag")
+		}
+		if err := attachLayer(
+			tag, static.NewLayer(envelope, dsseEnvelopeMediaType),
+			map[string]string{predicateTypeAnnotation: slsaProvenanceType},
+			withAnnotation(predicateTypeAnnotation, slsaProvenanceType),
+		); err != nil {
+			return errors.Wrapf(err, "attaching provenance to %s", digest)
+		}
+		logrus.Infof("📜 Provenance of %s from commit %s attached to %s", ref, commit, tag)
 	}
 	return nil
 }
+
+// LoadState reads the state recorded by the stage. The version to build
+// defaults to the staged one and must match it if set.
+func (di *defaultBuildImplementation) LoadState(o *BuildOptions, s *State) error {
+	if err := loadState(o.StatePath(), s); err != nil {
+		return err
+	}
+	if o.Branch == "" {
+		o.Branch = s.Branch
+	}
+	if o.Branch != s.Branch {
+		return errors.Errorf("state was recorded for branch %s, not %s", s.Branch, o.Branch)
+	}
+	if o.VTBaseVersion == "" {
+		o.VTBaseVersion = s.Version
+	}
+	if o.VTBaseVersion != s.Version {
+		return errors.Errorf("state was recorded for version %s, not %s", s.Version, o.VTBaseVersion)
+	}
+	return nil
+}
+
+// SourceCommit returns the commit the release tag points to. If the
+// state of the staged release is loaded, the recorded release point is
+// used, otherwise the tag is looked up in the repository.
+func (di *defaultBuildImplementation) SourceCommit(o *BuildOptions, s *State) (string, error) {
+	if s.ReleasePoint != "" && s.Version == o.VTBaseVersion {
+		return s.ReleasePoint, nil
+	}
+	repo, err := git.OpenRepo(o.RepoPath)
+	if err != nil {
+		return "", errors.Wrap(err, "opening repository")
+	}
+	commit, err := repo.RevParse(o.VTBaseVersion)
+	if err != nil {
+		return "", errors.Wrapf(err, "resolving commit of tag %s", o.VTBaseVersion)
+	}
+	return commit, nil
+}
+
+// imagePlatforms returns the platforms (os/arch[/variant]) available
+// in a remote image reference, either an index or a single image
+func imagePlatforms(refString string) (map[string]bool, error) {
+	ref, err := name.ParseReference(refString)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing image reference")
+	}
+	desc, err := remote.Get(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching image descriptor")
+	}
+
+	platforms := map[string]bool{}
+	if !desc.MediaType.IsIndex() {
+		img, err := desc.Image()
+		if err != nil {
+			return nil, errors.Wrap(err, "reading image")
+		}
+		platform, err := imageConfigPlatform(img)
+		if err != nil {
+			return nil, err
+		}
+		platforms[platform] = true
+		return platforms, nil
+	}
+
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading image index")
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading index manifest")
+	}
+	for _, m := range manifest.Manifests {
+		if m.Platform == nil {
+			continue
+		}
+		platforms[platformString(m.Platform.OS, m.Platform.Architecture, m.Platform.Variant)] = true
+	}
+	return platforms, nil
+}
+
+// platformString formats a platform as os/arch[/variant]
+func platformString(os, arch, variant string) string {
+	if variant == "" {
+		return os + "/" + arch
+	}
+	return os + "/" + arch + "/" + variant
+}
+
+// platformImage is the image of one platform in a remote reference
+type platformImage struct {
+	Platform string
+	Digest   v1.Hash
+	Image    v1.Image
+}
+
+// platformImages returns the image of every platform in a remote
+// reference. The reference can point to an index or, for single
+// platform builds, to an image.
+func platformImages(ref name.Reference) ([]platformImage, error) {
+	desc, err := remote.Get(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching %s", ref)
+	}
+	if !desc.MediaType.IsIndex() {
+		img, err := desc.Image()
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading image %s", ref)
+		}
+		platform, err := imageConfigPlatform(img)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading platform of %s", ref)
+		}
+		return []platformImage{{Platform: platform, Digest: desc.Digest, Image: img}}, nil
+	}
+
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading index of %s", ref)
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading index of %s", ref)
+	}
+	images := []platformImage{}
+	for _, m := range manifest.Manifests {
+		if m.Platform == nil || m.Platform.OS == "unknown" {
+			continue
+		}
+		img, err := idx.Image(m.Digest)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetching %s image", m.Digest)
+		}
+		images = append(images, platformImage{
+			Platform: platformString(m.Platform.OS, m.Platform.Architecture, m.Platform.Variant),
+			Digest:   m.Digest,
+			Image:    img,
+		})
+	}
+	return images, nil
+}
+
+// imageConfigPlatform returns the platform recorded in the config of a
+// single platform image. The variant is read from the raw config as
+// v1.ConfigFile does not have it.
+func imageConfigPlatform(img v1.Image) (string, error) {
+	data, err := img.RawConfigFile()
+	if err != nil {
+		return "", errors.Wrap(err, "reading image config")
+	}
+	conf := struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant"`
+	}{}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return "", errors.Wrap(err, "parsing image config")
+	}
+	return platformString(conf.OS, conf.Architecture, conf.Variant), nil
+}
+
+// defaultPlatformVariants are the variants assumed for the architectures
+// when a platform does not specify one
+var defaultPlatformVariants = map[string]string{
+	"arm64": "v8",
+	"arm":   "v7",
+}
+
+// normalizePlatform returns the os/arch/variant form of a platform so
+// that linux/arm64 and linux/arm64/v8 compare equal
+func normalizePlatform(platform string) string {
+	parts := strings.SplitN(platform, "/", 3)
+	if len(parts) == 2 {
+		if variant, ok := defaultPlatformVariants[parts[1]]; ok {
+			parts = append(parts, variant)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// imageSpec describes where an image is built from
+type imageSpec struct {
+	// WorkDir is the directory where the build runs
+	WorkDir string
+
+	// Context is the build context, relative to WorkDir
+	Context string
+
+	// Dockerfile is the path to the Dockerfile, relative to WorkDir
+	Dockerfile string
+}
+
+// imageBuildRequest captures everything needed to build an image variant
+type imageBuildRequest struct {
+	imageSpec
+
+	// Name of the image and debian version of the variant
+	Name   string
+	Distro string
+
+	// Full references the image will be pushed to
+	Tags []string
+
+	// Build arguments as KEY=VALUE
+	BuildArgs []string
+
+	// Platforms to build for
+	Platforms []string
+
+	// BaseImages maps the base images referenced in the Dockerfile
+	// to the images built by the release
+	BaseImages map[string]string
+}
+
+// Names of the images with a special location in the repository
+const (
+	k8sImagesDir = "docker/k8s"
+	k8sBaseImage = "k8s"
+)
+
+// fromVitessImage matches the vitess images in the FROM lines of a Dockerfile
+var fromVitessImage = regexp.MustCompile(`(?mi)^\s*FROM\s+(?:--platform=\S+\s+)?vitess/([a-z0-9_.-]+)`)
+
+// imageBuildSpec locates an image in the repository. Images in
+// docker/k8s/NAME are built there, the k8s image is the Dockerfile in
+// docker/k8s and other images like base and lite are built from the
+// repository root with their Dockerfile in docker/NAME.
+func imageBuildSpec(repoPath, imageName string) (*imageSpec, error) {
+	k8sDir := filepath.Join(repoPath, k8sImagesDir)
+	switch {
+	case imageName == k8sBaseImage && util.Exists(filepath.Join(k8sDir, "Dockerfile")):
+		return &imageSpec{WorkDir: k8sDir, Context: ".", Dockerfile: "Dockerfile"}, nil
+	case util.Exists(filepath.Join(k8sDir, imageName, "Dockerfile")):
+		return &imageSpec{
+			WorkDir: k8sDir, Context: imageName, Dockerfile: filepath.Join(imageName, "Dockerfile"),
+		}, nil
+	case util.Exists(filepath.Join(repoPath, "docker", imageName, "Dockerfile")):
+		return &imageSpec{
+			WorkDir: repoPath, Context: ".", Dockerfile: filepath.Join("docker", imageName, "Dockerfile"),
+		}, nil
+	}
+	return nil, errors.Errorf("unable to find a Dockerfile for image %s", imageName)
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
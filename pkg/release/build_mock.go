@@ -0,0 +1,136 @@
+package release
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// mockBuildImplementation runs the build validations but only logs the
+// commands that would build and push the images.
+type mockBuildImplementation struct {
+	defaultBuildImplementation
+	mockRecorder
+}
+
+func (mi *mockBuildImplementation) BuildImage(o *BuildOptions, s *State, imageName string) error {
+	builder, err := newImageBuilder(o.Builder)
+	if err != nil {
+		return err
+	}
+	for _, distro := range o.DebianVersions {
+		req, err := mi.buildRequest(o, s, imageName, distro)
+		if err != nil {
+			return errors.Wrapf(err, "preparing build of %s", imageName)
+		}
+		for _, cmd := range builder.Commands(req) {
+			mi.record("run %s %s in %s", cmd.Name, strings.Join(cmd.Args, " "), cmd.WorkDir)
+		}
+	}
+	return nil
+}
+
+// VerifyImagePlatforms logs the platforms that would be verified
+func (mi *mockBuildImplementation) VerifyImagePlatforms(o *BuildOptions, s *State, imageName string) error {
+	mi.record("verify %s images have platforms %s", imageName, strings.Join(o.Platforms, ", "))
+	return nil
+}
+
+// GenerateSBOMs logs the SBOMs that would be generated
+func (mi *mockBuildImplementation) GenerateSBOMs(o *BuildOptions, s *State, imageName string) error {
+	mi.record("generate SBOMs of %s images in %s", imageName, filepath.Join(o.ArtifactsDir, "sbom"))
+	return nil
+}
+
+// AttestImage logs the provenance attestations that would be pushed
+func (mi *mockBuildImplementation) AttestImage(
+	o *BuildOptions, s *State, imageName string, started, finished time.Time,
+) error {
+	if o.SigningKey == "" {
+		logrus.Warnf("  🧪 [mock] No signing key defined, skipping attestation of %s images", imageName)
+		return nil
+	}
+	mi.record("attach signed provenance attestations to %s images", imageName)
+	return nil
+}
+
+// ImageDigests logs the digests that would be read, no images are
+// pushed in mock mode
+func (mi *mockBuildImplementation) ImageDigests(o *BuildOptions, s *State, imageName string) ([]ImageDigest, error) {
+	mi.record("read the digests of the pushed %s images", imageName)
+	return nil, nil
+}
+
+// WriteReleaseManifest logs the release manifest that would be written
+func (mi *mockBuildImplementation) WriteReleaseManifest(o *BuildOptions, s *State) error {
+	mi.record("write %d images to %s", len(s.Images), filepath.Join(o.ArtifactsDir, releaseManifestFile))
+	return nil
+}
+
+// CheckoutSource logs the worktree that would be created, the mock
+// uses the repository itself as the source
+func (mi *mockBuildImplementation) CheckoutSource(o *BuildOptions, s *State) (dir, commit string, err error) {
+	commit, err = mi.SourceCommit(o, s)
+	if err != nil {
+		return "", "", err
+	}
+	mi.record("create a worktree of %s at %s", o.RepoPath, commit)
+	return o.RepoPath, commit, nil
+}
+
+// RemoveSource does nothing as the mock does not create a worktree
+func (mi *mockBuildImplementation) RemoveSource(o *BuildOptions, dir string) error {
+	return nil
+}
+
+// CompileBinaries logs the go build command that would run
+func (mi *mockBuildImplementation) CompileBinaries(
+	o *BuildOptions, s *State, srcDir, commit, platform string,
+) (string, error) {
+	env, err := goPlatformEnv(platform)
+	if err != nil {
+		return "", err
+	}
+	binDir := filepath.Join(os.TempDir(), "vtrelease-bin", strings.ReplaceAll(platform, "/", "-"))
+	mi.record(
+		"run %s go %s in %s", strings.Join(env, " "),
+		strings.Join(goBuildArgs(o.VTBaseVersion, commit, binDir), " "), srcDir,
+	)
+	return binDir, nil
+}
+
+// PackageBinaries logs the tarball that would be written
+func (mi *mockBuildImplementation) PackageBinaries(
+	o *BuildOptions, s *State, srcDir, binDir, packageName string,
+) (string, error) {
+	tarball := filepath.Join(binariesDir(o), packageName+".tar.gz")
+	mi.record("package the binaries in %s into %s", binDir, tarball)
+	return tarball, nil
+}
+
+// WriteChecksums logs the checksums file that would be written
+func (mi *mockBuildImplementation) WriteChecksums(o *BuildOptions, dir string, files []string) error {
+	mi.record("write the checksums of %d files to %s", len(files), filepath.Join(dir, checksumsFile))
+	return nil
+}
+
+// ExtractBinaries logs the tarball that would be extracted
+func (mi *mockBuildImplementation) ExtractBinaries(o *BuildOptions, s *State, tarball, dest string) (string, error) {
+	mi.record("extract %s into %s", tarball, dest)
+	return filepath.Join(dest, strings.TrimSuffix(filepath.Base(tarball), ".tar.gz")), nil
+}
+
+// BuildPackage logs the package that would be built
+func (mi *mockBuildImplementation) BuildPackage(
+	o *BuildOptions, s *State, format, version, platform, binDir string,
+) (string, error) {
+	mi.record("build %s %s package for %s from %s", format, version, platform, binDir)
+	return filepath.Join(packagesDir(o), fmt.Sprintf(
+		"%s-%s-%s.%s", packageName, version, strings.ReplaceAll(platform, "/", "-"), format,
+	)), nil
+}
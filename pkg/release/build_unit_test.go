@@ -0,0 +1,459 @@
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRegistry starts an in-process registry and returns its host
+func newTestRegistry(t *testing.T) string {
+	s := httptest.NewServer(registry.New())
+	t.Cleanup(s.Close)
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	return u.Host
+}
+
+// pushTestIndex pushes a random multi-arch index with platforms to ref
+func pushTestIndex(t *testing.T, ref string, platforms ...v1.Platform) v1.ImageIndex {
+	var idx v1.ImageIndex = empty.Index
+	for i := range platforms {
+		img, err := random.Image(1024, 1)
+		require.NoError(t, err)
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &platforms[i]},
+		})
+	}
+	r, err := name.ParseReference(ref)
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(r, idx))
+	return idx
+}
+
+func TestImagePlatforms(t *testing.T) {
+	reg := newTestRegistry(t)
+	ref := fmt.Sprintf("%s/vitess/vtgate:v12.0.4-buster", reg)
+	pushTestIndex(t, ref,
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+	)
+
+	platforms, err := imagePlatforms(ref)
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"linux/amd64": true, "linux/arm64/v8": true}, platforms)
+
+	impl := &defaultBuildImplementation{}
+	opts := &BuildOptions{
+		StagingRegistry: reg + "/vitess",
+		VTBaseVersion:   "v12.0.4",
+		DebianVersions:  []string{"buster"},
+		Platforms:       []string{"linux/amd64", "linux/arm64/v8"},
+	}
+	require.NoError(t, impl.VerifyImagePlatforms(opts, &State{}, "vtgate"))
+
+	// Platforms without a variant match the default one
+	opts.Platforms = []string{"linux/amd64", "linux/arm64"}
+	require.NoError(t, impl.VerifyImagePlatforms(opts, &State{}, "vtgate"))
+
+	opts.Platforms = []string{"linux/amd64", "linux/s390x"}
+	require.Error(t, impl.VerifyImagePlatforms(opts, &State{}, "vtgate"))
+
+	// Single images report the platform in their config
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	conf, err := img.ConfigFile()
+	require.NoError(t, err)
+	conf.OS, conf.Architecture = "linux", "arm64"
+	img, err = mutate.ConfigFile(img, conf)
+	require.NoError(t, err)
+	single, err := name.ParseReference(fmt.Sprintf("%s/vitess/vtgate:v12.0.4-bullseye", reg))
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(single, img))
+	platforms, err = imagePlatforms(single.String())
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"linux/arm64": true}, platforms)
+
+	opts.DebianVersions = []string{"bullseye"}
+	opts.Platforms = []string{"linux/arm64/v8"}
+	require.NoError(t, impl.VerifyImagePlatforms(opts, &State{}, "vtgate"))
+}
+
+// rawConfigImage replaces the config of an image
+type rawConfigImage struct {
+	v1.Image
+	config string
+}
+
+func (i *rawConfigImage) RawConfigFile() ([]byte, error) {
+	return []byte(i.config), nil
+}
+
+func TestImageConfigPlatform(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	platform, err := imageConfigPlatform(&rawConfigImage{
+		Image: img, config: `{"os": "linux", "architecture": "arm", "variant": "v6"}`,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "linux/arm/v6", platform)
+
+	_, err = imageConfigPlatform(&rawConfigImage{Image: img, config: "not json"})
+	require.Error(t, err)
+}
+
+func TestNormalizePlatform(t *testing.T) {
+	for platform, expected := range map[string]string{
+		"linux/amd64":    "linux/amd64",
+		"linux/arm64":    "linux/arm64/v8",
+		"linux/arm64/v8": "linux/arm64/v8",
+		"linux/arm":      "linux/arm/v7",
+		"linux/arm/v6":   "linux/arm/v6",
+	} {
+		require.Equal(t, expected, normalizePlatform(platform), platform)
+	}
+}
+
+func TestImageTags(t *testing.T) {
+	repoTags := []string{
+		"v11.0.4", "v12.0.2", "v12.0.3", "v12.1.0", "v13.0.0-rc1", "v0.12.3", "not-semver",
+	}
+	for _, tc := range []struct {
+		version  string
+		distro   string
+		expected []string
+	}{
+		// Old patch in a minor line with newer releases, no floating tags
+		{"v12.0.2", "buster", []string{"v12.0.2-buster", "v12.0.2"}},
+		// Newest of the 12.0 line but not of 12
+		{"v12.0.3", "buster", []string{"v12.0.3-buster", "v12.0.3", "v12.0"}},
+		// Newest of 12, but 13 has only a release candidate
+		{"v12.1.0", "buster", []string{"v12.1.0-buster", "v12.1.0", "v12.1", "v12", "latest"}},
+		// Non default variants get suffixed floating tags and no bare tag
+		{"v12.1.0", "bullseye", []string{"v12.1.0-bullseye", "v12.1-bullseye", "v12-bullseye", "latest-bullseye"}},
+		// Pre-releases never get floating tags
+		{"v13.0.0-rc1", "buster", []string{"v13.0.0-rc1-buster", "v13.0.0-rc1"}},
+		// New release not tagged yet
+		{"v12.0.4", "buster", []string{"v12.0.4-buster", "v12.0.4", "v12.0"}},
+		// Versions without the v prefix
+		{"13.0.0", "buster", []string{"13.0.0-buster", "13.0.0", "13.0", "13", "latest"}},
+	} {
+		tags, err := imageTags(tc.version, tc.distro, "buster", repoTags)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, tags, "%s-%s", tc.version, tc.distro)
+	}
+
+	_, err := imageTags("twelve", "buster", "buster", repoTags)
+	require.Error(t, err)
+}
+
+// newTestImageTree creates a repository tree with vitess images
+func newTestImageTree(t *testing.T) string {
+	dir := t.TempDir()
+	for path, content := range map[string]string{
+		"docker/base/Dockerfile":       "FROM golang:1.17-buster AS builder\n",
+		"docker/lite/Dockerfile":       "FROM golang:1.17-buster AS builder\n",
+		"docker/k8s/Dockerfile":        "ARG VT_BASE_VER\nFROM vitess/base:${VT_BASE_VER} AS base\nFROM debian:buster-slim\n",
+		"docker/k8s/vtgate/Dockerfile": "ARG VT_BASE_VER\nFROM vitess/k8s:${VT_BASE_VER} AS k8s\nFROM debian:buster-slim\n",
+		"docker/k8s/vttablet/Dockerfile": "ARG VT_BASE_VER\n" +
+			"FROM --platform=linux/amd64 vitess/k8s:${VT_BASE_VER} AS k8s\nFROM vitess/vtgate AS gate\n",
+		"docker/k8s/README.md": "Images\n",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), os.FileMode(0o755)))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(content), os.FileMode(0o644)))
+	}
+	return dir
+}
+
+// newTestImageRepo creates a git repository with the vitess images tree
+// and a release tag. Returns its path and the tagged commit.
+func newTestImageRepo(t *testing.T, version string) (repoPath, commit string) {
+	repoPath = newTestImageTree(t)
+	return repoPath, commitAndTag(t, repoPath, version)
+}
+
+func TestDiscoverImages(t *testing.T) {
+	opts := &BuildOptions{RepoPath: newTestImageTree(t)}
+	impl := &defaultBuildImplementation{}
+
+	images, err := impl.DiscoverImages(opts)
+	require.NoError(t, err)
+	require.Equal(t, []string{"base", "k8s", "vtgate", "vttablet"}, images)
+
+	deps, err := impl.ImageDependencies(opts, "vttablet")
+	require.NoError(t, err)
+	require.Equal(t, []string{"k8s", "vtgate"}, deps)
+
+	spec, err := imageBuildSpec(opts.RepoPath, "base")
+	require.NoError(t, err)
+	require.Equal(t, opts.RepoPath, spec.WorkDir)
+	require.Equal(t, filepath.Join("docker", "base", "Dockerfile"), spec.Dockerfile)
+
+	_, err = imageBuildSpec(opts.RepoPath, "vtnothing")
+	require.Error(t, err)
+}
+
+// orderBuildImplementation records the order in which images are built
+// and fails the images listed in fail
+type orderBuildImplementation struct {
+	defaultBuildImplementation
+	mtx   sync.Mutex
+	built []string
+	fail  map[string]bool
+}
+
+func (oi *orderBuildImplementation) BuildImage(o *BuildOptions, s *State, imageName string) error {
+	oi.mtx.Lock()
+	defer oi.mtx.Unlock()
+	oi.built = append(oi.built, imageName)
+	if oi.fail[imageName] {
+		return errors.New("build failed")
+	}
+	return nil
+}
+
+func (oi *orderBuildImplementation) ValidateImageOpts(*BuildOptions, *State, string) error {
+	return nil
+}
+
+func (oi *orderBuildImplementation) VerifyImagePlatforms(*BuildOptions, *State, string) error {
+	return nil
+}
+
+func (oi *orderBuildImplementation) GenerateSBOMs(*BuildOptions, *State, string) error {
+	return nil
+}
+
+func (oi *orderBuildImplementation) ImageDigests(o *BuildOptions, s *State, imageName string) ([]ImageDigest, error) {
+	return []ImageDigest{{Image: imageName, Distro: "buster", Digest: "sha256:" + imageName}}, nil
+}
+
+func (oi *orderBuildImplementation) WriteReleaseManifest(*BuildOptions, *State) error {
+	return nil
+}
+
+func (oi *orderBuildImplementation) AttestImage(*BuildOptions, *State, string, time.Time, time.Time) error {
+	return nil
+}
+
+func TestBuildImagesOrder(t *testing.T) {
+	impl := &orderBuildImplementation{}
+	sut := &Build{impl: impl, Options: BuildOptions{RepoPath: newTestImageTree(t), Jobs: 3}}
+	results, err := sut.AllImages()
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+	require.Equal(t, []string{"base", "k8s", "vtgate", "vttablet"}, impl.built)
+	digests := []string{}
+	for _, image := range sut.State.Images {
+		digests = append(digests, image.Digest)
+	}
+	require.Equal(t, []string{"sha256:base", "sha256:k8s", "sha256:vtgate", "sha256:vttablet"}, digests)
+
+	// A failed dependency skips its dependents but not the rest
+	impl = &orderBuildImplementation{fail: map[string]bool{"vtgate": true}}
+	sut = &Build{impl: impl, Options: BuildOptions{RepoPath: sut.Options.RepoPath, Jobs: 3}}
+	results, err = sut.Images([]string{"vttablet", "vtgate", "lite"})
+	require.Error(t, err)
+	require.ElementsMatch(t, []string{"lite", "vtgate"}, impl.built)
+	require.Equal(t, "vttablet", results[0].Image)
+	require.True(t, results[0].Skipped)
+	require.Error(t, results[1].Error)
+	require.NoError(t, results[2].Error)
+}
+
+func TestBuildLoadState(t *testing.T) {
+	opts := BuildOptions{StateFile: filepath.Join(t.TempDir(), "state.json"), NoMock: true}
+	state := &State{
+		Branch: "release-12.0", Version: "v12.0.4", ReleasePoint: "abc123", NoMock: true,
+		Steps: []string{stepPrepareEnvironment, stepReleaseNotes},
+	}
+	require.NoError(t, saveState(opts.StateFile, state))
+
+	// Nothing is loaded without a branch or state file
+	sut := NewBuild(BuildOptions{NoMock: true})
+	require.NoError(t, sut.LoadState())
+	require.Empty(t, sut.State.Version)
+
+	// Releases that did not finish staging cannot be built
+	require.Error(t, NewBuild(opts).LoadState())
+
+	// The version to build defaults to the staged one
+	state.CompleteStep(stepTagRepository)
+	require.NoError(t, saveState(opts.StateFile, state))
+	sut = NewBuild(opts)
+	require.NoError(t, sut.LoadState())
+	require.Equal(t, "v12.0.4", sut.Options.VTBaseVersion)
+	require.Equal(t, "release-12.0", sut.Options.Branch)
+	commit, err := sut.impl.SourceCommit(&sut.Options, &sut.State)
+	require.NoError(t, err)
+	require.Equal(t, "abc123", commit)
+
+	// Other versions and branches are rejected
+	other := opts
+	other.VTBaseVersion = "v12.0.5"
+	require.Error(t, NewBuild(other).LoadState())
+	other = opts
+	other.Branch = "release-13.0"
+	require.Error(t, NewBuild(other).LoadState())
+
+	// Mock stages cannot be built for real
+	state.NoMock = false
+	require.NoError(t, saveState(opts.StateFile, state))
+	require.Error(t, NewBuild(opts).LoadState())
+	opts.NoMock = false
+	require.NoError(t, NewBuild(opts).LoadState())
+}
+
+func TestValidateImageOpts(t *testing.T) {
+	repo := newTestRepo(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(repo.Dir(), "docker/k8s/vtgate"), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(repo.Dir(), "docker/k8s/vtgate/Dockerfile"), []byte("FROM debian\n"), os.FileMode(0o644),
+	))
+	runGit(t, repo.Dir(), "add", ".")
+	runGit(t, repo.Dir(), "commit", "-m", "Add vtgate image")
+	runGit(t, repo.Dir(), "tag", "v12.0.4")
+
+	impl := &defaultBuildImplementation{}
+	opts := DefaultBuildOptions
+	opts.RepoPath = repo.Dir()
+	opts.VTBaseVersion = "v12.0.4"
+	require.NoError(t, impl.ValidateImageOpts(&opts, &State{}, "vtgate"))
+
+	// Real builds must attest the images
+	opts.NoMock = true
+	err := impl.ValidateImageOpts(&opts, &State{}, "vtgate")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "a signing key is required")
+	opts.SigningKey, _ = newTestKeyPair(t)
+	require.NoError(t, impl.ValidateImageOpts(&opts, &State{}, "vtgate"))
+
+	// Images are built from the checkout, it has to match the release
+	require.NoError(t, os.WriteFile(filepath.Join(repo.Dir(), "README.md"), []byte("changed\n"), os.FileMode(0o644)))
+	err = impl.ValidateImageOpts(&opts, &State{}, "vtgate")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "repository has uncommitted changes")
+	runGit(t, repo.Dir(), "commit", "-am", "Change after the release")
+	err = impl.ValidateImageOpts(&opts, &State{}, "vtgate")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "but v12.0.4 was released from")
+	runGit(t, repo.Dir(), "checkout", "v12.0.4")
+	require.NoError(t, impl.ValidateImageOpts(&opts, &State{}, "vtgate"))
+
+	// All problems are reported at once
+	opts.VTBaseVersion = "v12.0.5"
+	opts.DebianVersions = []string{"buster", "jessy"}
+	opts.DefaultDebianVersion = "bullseye"
+	opts.StagingRegistry = "Not A Registry"
+	err = impl.ValidateImageOpts(&opts, &State{}, "vtgatee")
+	require.Error(t, err)
+	for _, problem := range []string{
+		`unknown debian version "jessy"`,
+		`default debian version "bullseye"`,
+		`invalid staging registry "Not A Registry"`,
+		"unable to find a Dockerfile for image vtgatee",
+		"version v12.0.5 is not tagged",
+	} {
+		require.Contains(t, err.Error(), problem)
+	}
+
+	opts = DefaultBuildOptions
+	opts.RepoPath = repo.Dir()
+	opts.VTBaseVersion = "twelve"
+	require.Contains(t, opts.Validate().Error(), `version "twelve" is not a valid semantic version`)
+}
+
+func TestImageDigests(t *testing.T) {
+	repoPath, _ := newTestImageRepo(t, "v12.0.4")
+	reg := newTestRegistry(t) + "/vitess"
+	platforms := []v1.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64"},
+	}
+	idx := pushTestIndex(t, reg+"/vtgate:v12.0.4-buster", platforms...)
+	tags := []string{"v12.0.4-buster", "v12.0.4", "v12.0", "v12", "latest"}
+	for _, tag := range tags[1:] {
+		ref, err := name.ParseReference(reg + "/vtgate:" + tag)
+		require.NoError(t, err)
+		require.NoError(t, remote.WriteIndex(ref, idx))
+	}
+	digest, err := idx.Digest()
+	require.NoError(t, err)
+	manifest, err := idx.IndexManifest()
+	require.NoError(t, err)
+
+	opts := DefaultBuildOptions
+	opts.RepoPath = repoPath
+	opts.VTBaseVersion = "v12.0.4"
+	opts.DebianVersions = []string{"buster"}
+	opts.StagingRegistry = reg
+	opts.ArtifactsDir = t.TempDir()
+	impl := &defaultBuildImplementation{}
+
+	digests, err := impl.ImageDigests(&opts, &State{}, "vtgate")
+	require.NoError(t, err)
+	expected := ImageDigest{
+		Image:      "vtgate",
+		Distro:     "buster",
+		Repository: reg + "/vtgate",
+		Digest:     digest.String(),
+		Tags:       tags,
+		Platforms: map[string]string{
+			"linux/amd64": manifest.Manifests[0].Digest.String(),
+			"linux/arm64": manifest.Manifests[1].Digest.String(),
+		},
+	}
+	require.Equal(t, []ImageDigest{expected}, digests)
+
+	// Recording a variant again replaces it in the state and the manifest
+	sut := &Build{impl: impl, Options: opts}
+	require.NoError(t, sut.recordImages([]ImageDigest{{Image: "vttablet", Distro: "buster"}}))
+	require.NoError(t, sut.recordImages([]ImageDigest{{Image: "vtgate", Distro: "buster"}}))
+	require.NoError(t, sut.recordImages(digests))
+	require.Len(t, sut.State.Images, 2)
+
+	data, err := os.ReadFile(filepath.Join(opts.ArtifactsDir, releaseManifestFile))
+	require.NoError(t, err)
+	releaseManifest := ReleaseManifest{}
+	require.NoError(t, json.Unmarshal(data, &releaseManifest))
+	require.Equal(t, "v12.0.4", releaseManifest.Version)
+	require.Equal(t, expected, releaseManifest.Images[0])
+	require.Equal(t, "vttablet", releaseManifest.Images[1].Image)
+
+	// Images written by earlier runs are kept in the manifest
+	rerun := &Build{impl: impl, Options: opts}
+	require.NoError(t, rerun.recordImages([]ImageDigest{{Image: "lite", Distro: "buster"}}))
+	data, err = os.ReadFile(filepath.Join(opts.ArtifactsDir, releaseManifestFile))
+	require.NoError(t, err)
+	releaseManifest = ReleaseManifest{}
+	require.NoError(t, json.Unmarshal(data, &releaseManifest))
+	require.Len(t, releaseManifest.Images, 3)
+	require.Equal(t, "lite", releaseManifest.Images[0].Image)
+	require.Equal(t, expected, releaseManifest.Images[1])
+
+	// The manifest of another version is not mixed with this one
+	rerun.Options.VTBaseVersion = "v12.0.5"
+	require.Error(t, rerun.recordImages(digests))
+
+	// Tags of a variant pointing to other images are an error
+	pushTestIndex(t, reg+"/vtgate:latest", platforms...)
+	_, err = impl.ImageDigests(&opts, &State{}, "vtgate")
+	require.Error(t, err)
+}
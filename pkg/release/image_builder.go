@@ -0,0 +1,167 @@
+package release
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Container build backends
+const (
+	BuilderBuildx     = "buildx"
+	BuilderPodman     = "podman"
+	BuilderBuildah    = "buildah"
+	BuilderDaemonless = "daemonless"
+)
+
+// Builders lists the supported container build backends
+var Builders = []string{BuilderBuildx, BuilderPodman, BuilderBuildah, BuilderDaemonless}
+
+// imageBuilder translates an image build request into the commands
+// that build it and push it with a container build tool
+type imageBuilder interface {
+	// CheckTools verifies the tools the builder runs are installed
+	CheckTools() error
+
+	// Commands returns the commands to build and push the image
+	Commands(*imageBuildRequest) []builderCommand
+}
+
+// builderCommand is a command to run in a directory
+type builderCommand struct {
+	WorkDir string
+	Name    string
+	Args    []string
+
+	// MayFail marks cleanup commands whose failure does not stop the
+	// build, ie removing a manifest list that does not exist
+	MayFail bool
+}
+
+// newImageBuilder returns the builder for a backend name
+func newImageBuilder(name string) (imageBuilder, error) {
+	switch name {
+	case BuilderBuildx:
+		return &buildxBuilder{}, nil
+	case BuilderPodman, BuilderBuildah:
+		return &ociBuilder{tool: name}, nil
+	case BuilderDaemonless:
+		return &daemonlessBuilder{}, nil
+	}
+	return nil, errors.Errorf(
+		"unknown builder %q, must be one of %s", name, strings.Join(Builders, ", "),
+	)
+}
+
+// lookTools checks that all programs are in the path
+func lookTools(programs ...string) error {
+	for _, program := range programs {
+		if _, err := exec.LookPath(program); err != nil {
+			return errors.Wrapf(err, "checking for %s in the system", program)
+		}
+	}
+	return nil
+}
+
+// buildxBuilder builds and pushes in one step with docker buildx
+type buildxBuilder struct{}
+
+func (bb *buildxBuilder) CheckTools() error {
+	return lookTools("docker")
+}
+
+func (bb *buildxBuilder) Commands(req *imageBuildRequest) []builderCommand {
+	args := []string{
+		"buildx", "build",
+		"--platform", strings.Join(req.Platforms, ","),
+		"--file", req.Dockerfile,
+	}
+	for _, arg := range req.BuildArgs {
+		args = append(args, "--build-arg", arg)
+	}
+	for _, base := range sortedKeys(req.BaseImages) {
+		args = append(args, "--build-context", fmt.Sprintf("%s=docker-image://%s", base, req.BaseImages[base]))
+	}
+	for _, tag := range req.Tags {
+		args = append(args, "--tag", tag)
+	}
+	args = append(args, "--output", "type=image,push=true", req.Context)
+	return []builderCommand{{WorkDir: req.WorkDir, Name: "docker", Args: args}}
+}
+
+// ociBuilder builds a manifest list with podman or buildah and then
+// pushes it to every tag. A local manifest list left by an earlier build
+// is removed first, otherwise the new images are appended to it.
+type ociBuilder struct {
+	tool string
+}
+
+func (ob *ociBuilder) CheckTools() error {
+	return lookTools(ob.tool)
+}
+
+func (ob *ociBuilder) Commands(req *imageBuildRequest) []builderCommand {
+	if len(req.Tags) == 0 {
+		return nil
+	}
+	manifest := req.Tags[0]
+	args := []string{
+		"build",
+		"--platform", strings.Join(req.Platforms, ","),
+		"--file", req.Dockerfile,
+		"--manifest", manifest,
+	}
+	for _, arg := range req.BuildArgs {
+		args = append(args, "--build-arg", arg)
+	}
+	for _, base := range sortedKeys(req.BaseImages) {
+		args = append(args, "--build-context", fmt.Sprintf("%s=docker-image://%s", base, req.BaseImages[base]))
+	}
+	cmds := []builderCommand{
+		{WorkDir: req.WorkDir, Name: ob.tool, Args: []string{"manifest", "rm", manifest}, MayFail: true},
+		{WorkDir: req.WorkDir, Name: ob.tool, Args: append(args, req.Context)},
+	}
+
+	for _, tag := range req.Tags {
+		cmds = append(cmds, builderCommand{
+			WorkDir: req.WorkDir,
+			Name:    ob.tool,
+			Args:    []string{"manifest", "push", "--all", manifest, "docker://" + tag},
+		})
+	}
+	return cmds
+}
+
+// daemonlessBuilder runs buildkit without a daemon using the
+// buildctl-daemonless.sh wrapper shipped with buildkit
+type daemonlessBuilder struct{}
+
+const buildctlDaemonless = "buildctl-daemonless.sh"
+
+func (db *daemonlessBuilder) CheckTools() error {
+	return lookTools(buildctlDaemonless, "buildkitd")
+}
+
+func (db *daemonlessBuilder) Commands(req *imageBuildRequest) []builderCommand {
+	args := []string{
+		"build",
+		"--frontend", "dockerfile.v0",
+		"--local", "context=" + req.Context,
+		"--local", "dockerfile=" + filepath.Dir(req.Dockerfile),
+		"--opt", "filename=" + filepath.Base(req.Dockerfile),
+		"--opt", "platform=" + strings.Join(req.Platforms, ","),
+	}
+	for _, arg := range req.BuildArgs {
+		args = append(args, "--opt", "build-arg:"+arg)
+	}
+	for _, base := range sortedKeys(req.BaseImages) {
+		args = append(args, "--opt", fmt.Sprintf("context:%s=docker-image://%s", base, req.BaseImages[base]))
+	}
+	args = append(args, "--output", fmt.Sprintf(
+		"type=image,\"name=%s\",push=true", strings.Join(req.Tags, ","),
+	))
+	return []builderCommand{{WorkDir: req.WorkDir, Name: buildctlDaemonless, Args: args}}
+}
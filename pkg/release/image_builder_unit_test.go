@@ -0,0 +1,76 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageBuilders(t *testing.T) {
+	req := &imageBuildRequest{
+		imageSpec: imageSpec{WorkDir: "/vitess/docker/k8s", Context: "vtgate", Dockerfile: "vtgate/Dockerfile"},
+		Name:      "vtgate",
+		Distro:    "buster",
+		Tags:      []string{"registry.local/vitess/vtgate:v12.0.4-buster", "registry.local/vitess/vtgate:v12.0.4"},
+		BuildArgs: []string{"VT_BASE_VER=v12.0.4", "DEBIAN_VER=buster-slim"},
+		Platforms: []string{"linux/amd64", "linux/arm64"},
+		BaseImages: map[string]string{
+			"vitess/k8s:v12.0.4": "registry.local/vitess/k8s:v12.0.4-buster",
+		},
+	}
+
+	for _, tc := range []struct {
+		builder  string
+		expected []builderCommand
+	}{
+		{BuilderBuildx, []builderCommand{{
+			WorkDir: "/vitess/docker/k8s", Name: "docker", Args: []string{
+				"buildx", "build", "--platform", "linux/amd64,linux/arm64", "--file", "vtgate/Dockerfile",
+				"--build-arg", "VT_BASE_VER=v12.0.4", "--build-arg", "DEBIAN_VER=buster-slim",
+				"--build-context", "vitess/k8s:v12.0.4=docker-image://registry.local/vitess/k8s:v12.0.4-buster",
+				"--tag", "registry.local/vitess/vtgate:v12.0.4-buster", "--tag", "registry.local/vitess/vtgate:v12.0.4",
+				"--output", "type=image,push=true", "vtgate",
+			},
+		}}},
+		{BuilderPodman, []builderCommand{
+			{WorkDir: "/vitess/docker/k8s", Name: "podman", Args: []string{
+				"manifest", "rm", "registry.local/vitess/vtgate:v12.0.4-buster",
+			}, MayFail: true},
+			{WorkDir: "/vitess/docker/k8s", Name: "podman", Args: []string{
+				"build", "--platform", "linux/amd64,linux/arm64", "--file", "vtgate/Dockerfile",
+				"--manifest", "registry.local/vitess/vtgate:v12.0.4-buster",
+				"--build-arg", "VT_BASE_VER=v12.0.4", "--build-arg", "DEBIAN_VER=buster-slim",
+				"--build-context", "vitess/k8s:v12.0.4=docker-image://registry.local/vitess/k8s:v12.0.4-buster",
+				"vtgate",
+			}},
+			{WorkDir: "/vitess/docker/k8s", Name: "podman", Args: []string{
+				"manifest", "push", "--all", "registry.local/vitess/vtgate:v12.0.4-buster",
+				"docker://registry.local/vitess/vtgate:v12.0.4-buster",
+			}},
+			{WorkDir: "/vitess/docker/k8s", Name: "podman", Args: []string{
+				"manifest", "push", "--all", "registry.local/vitess/vtgate:v12.0.4-buster",
+				"docker://registry.local/vitess/vtgate:v12.0.4",
+			}},
+		}},
+		{BuilderDaemonless, []builderCommand{{
+			WorkDir: "/vitess/docker/k8s", Name: buildctlDaemonless, Args: []string{
+				"build", "--frontend", "dockerfile.v0", "--local", "context=vtgate", "--local", "dockerfile=vtgate",
+				"--opt", "filename=Dockerfile", "--opt", "platform=linux/amd64,linux/arm64",
+				"--opt", "build-arg:VT_BASE_VER=v12.0.4", "--opt", "build-arg:DEBIAN_VER=buster-slim",
+				"--opt", "context:vitess/k8s:v12.0.4=docker-image://registry.local/vitess/k8s:v12.0.4-buster",
+				"--output", `type=image,"name=registry.local/vitess/vtgate:v12.0.4-buster,registry.local/vitess/vtgate:v12.0.4",push=true`,
+			},
+		}}},
+	} {
+		builder, err := newImageBuilder(tc.builder)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, builder.Commands(req), tc.builder)
+	}
+
+	builder, err := newImageBuilder(BuilderBuildah)
+	require.NoError(t, err)
+	require.Equal(t, "buildah", builder.Commands(req)[0].Name)
+
+	_, err = newImageBuilder("kaniko")
+	require.Error(t, err)
+}
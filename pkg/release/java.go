@@ -0,0 +1,272 @@
+package release
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// javaVersion returns the maven version of a release tag
+func javaVersion(tag string) string {
+	return strings.TrimPrefix(tag, "v")
+}
+
+// pomNode is an element of a pom.xml file. Start and End are the
+// offsets of the element content in the file.
+type pomNode struct {
+	Name     string
+	Children []*pomNode
+	Text     string
+	Start    int64
+	End      int64
+}
+
+// child returns the first child element called name or nil
+func (n *pomNode) child(name string) *pomNode {
+	if n == nil {
+		return nil
+	}
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// childText returns the text of the child element called name
+func (n *pomNode) childText(name string) string {
+	if c := n.child(name); c != nil {
+		return strings.TrimSpace(c.Text)
+	}
+	return ""
+}
+
+// pomFile is a parsed maven module
+type pomFile struct {
+	// Path of the pom.xml relative to the repository
+	Path    string
+	data    []byte
+	project *pomNode
+}
+
+// parsePom reads the pom.xml at path keeping the location of every element
+func parsePom(repoPath, path string) (*pomFile, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, path))
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", path)
+	}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	root := &pomNode{}
+	stack := []*pomNode{root}
+	for {
+		// The offset before reading a token is where the previous one ended
+		offset := d.InputOffset()
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", path)
+		}
+		current := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			node := &pomNode{Name: t.Name.Local, Start: d.InputOffset()}
+			current.Children = append(current.Children, node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			current.End = offset
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			current.Text += string(t)
+		}
+	}
+	project := root.child("project")
+	if project == nil {
+		return nil, errors.Errorf("%s is not a maven project", path)
+	}
+	return &pomFile{Path: path, data: data, project: project}, nil
+}
+
+// GroupID returns the group of the module, inherited from the parent if not set
+func (p *pomFile) GroupID() string {
+	if id := p.project.childText("groupId"); id != "" {
+		return id
+	}
+	return p.project.child("parent").childText("groupId")
+}
+
+// ArtifactID returns the name of the module
+func (p *pomFile) ArtifactID() string {
+	return p.project.childText("artifactId")
+}
+
+// Version returns the version of the module, inherited from the parent if not set
+func (p *pomFile) Version() string {
+	if v := p.project.childText("version"); v != "" {
+		return v
+	}
+	return p.project.child("parent").childText("version")
+}
+
+// coordinates identifies a module as groupId:artifactId
+func coordinates(node *pomNode, defaultGroup string) string {
+	group := node.childText("groupId")
+	if group == "" {
+		group = defaultGroup
+	}
+	return group + ":" + node.childText("artifactId")
+}
+
+// versionNodes returns the version elements to set when the modules in
+// reactor are bumped: the project version, the parent version if it is
+// built in the reactor and the versions of the dependencies on reactor
+// modules that are not set from a property
+func (p *pomFile) versionNodes(reactor map[string]bool) []*pomNode {
+	nodes := []*pomNode{}
+	if v := p.project.child("version"); v != nil {
+		nodes = append(nodes, v)
+	}
+	if parent := p.project.child("parent"); parent != nil && reactor[coordinates(parent, "")] {
+		if v := parent.child("version"); v != nil {
+			nodes = append(nodes, v)
+		}
+	}
+	for _, deps := range []*pomNode{
+		p.project.child("dependencies"),
+		p.project.child("dependencyManagement").child("dependencies"),
+	} {
+		if deps == nil {
+			continue
+		}
+		for _, dep := range deps.Children {
+			v := dep.child("version")
+			if dep.Name != "dependency" || v == nil || strings.Contains(v.Text, "${") {
+				continue
+			}
+			if reactor[coordinates(dep, p.GroupID())] {
+				nodes = append(nodes, v)
+			}
+		}
+	}
+	return nodes
+}
+
+// setVersion rewrites the version elements of the module in place,
+// leaving the rest of the file untouched. Returns true if it changed.
+func (p *pomFile) setVersion(reactor map[string]bool, version string) bool {
+	nodes := p.versionNodes(reactor)
+	// Replace from the end so the offsets remain valid
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Start > nodes[j].Start })
+	data := p.data
+	for _, node := range nodes {
+		content := string(data[node.Start:node.End])
+		trimmed := strings.TrimSpace(content)
+		if trimmed == version {
+			continue
+		}
+		// Keep any whitespace around the version
+		lead := content[:len(content)-len(strings.TrimLeft(content, " \t\r\n"))]
+		trail := content[len(strings.TrimRight(content, " \t\r\n")):]
+		replaced := append([]byte{}, data[:node.Start]...)
+		replaced = append(replaced, lead+version+trail...)
+		data = append(replaced, data[node.End:]...)
+	}
+	changed := !bytes.Equal(data, p.data)
+	p.data = data
+	return changed
+}
+
+// loadJavaModules parses every pom.xml in the java directory of repoPath
+func loadJavaModules(repoPath string) ([]*pomFile, error) {
+	paths, err := javaPomFiles(repoPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing java modules")
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("no pom.xml files found in the java directory")
+	}
+	modules := []*pomFile{}
+	for _, path := range paths {
+		pom, err := parsePom(repoPath, path)
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, pom)
+	}
+	return modules, nil
+}
+
+// reactorModules returns the coordinates of the modules
+func reactorModules(modules []*pomFile) map[string]bool {
+	reactor := map[string]bool{}
+	for _, m := range modules {
+		reactor[m.GroupID()+":"+m.ArtifactID()] = true
+	}
+	return reactor
+}
+
+// setJavaVersion patches the maven modules in repoPath to the version of
+// tag and verifies all of them were set
+func setJavaVersion(repoPath, tag string) error {
+	if tag == "" {
+		return errors.New("unable to set java version, empty tag")
+	}
+	version := javaVersion(tag)
+	modules, err := loadJavaModules(repoPath)
+	if err != nil {
+		return err
+	}
+	reactor := reactorModules(modules)
+	logrus.Infof("☕ Setting %d java modules to version %s", len(modules), version)
+	for _, m := range modules {
+		if !m.setVersion(reactor, version) {
+			logrus.Infof("  > %s already at version %s", m.Path, version)
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(repoPath, m.Path), m.data, os.FileMode(0o644)); err != nil {
+			return errors.Wrapf(err, "writing %s", m.Path)
+		}
+		logrus.Infof("  > Updated %s", m.Path)
+	}
+	return verifyJavaVersion(repoPath, tag)
+}
+
+// verifyJavaVersion checks every maven module in repoPath and the parents
+// built with them report the version of tag
+func verifyJavaVersion(repoPath, tag string) error {
+	version := javaVersion(tag)
+	modules, err := loadJavaModules(repoPath)
+	if err != nil {
+		return err
+	}
+	reactor := reactorModules(modules)
+	problems := []string{}
+	for _, m := range modules {
+		if v := m.Version(); v != version {
+			problems = append(problems, fmt.Sprintf(
+				"%s (%s) has version %q", m.Path, m.ArtifactID(), v,
+			))
+		}
+		parent := m.project.child("parent")
+		if parent != nil && reactor[coordinates(parent, "")] {
+			if v := parent.childText("version"); v != version {
+				problems = append(problems, fmt.Sprintf(
+					"%s (%s) has parent version %q", m.Path, m.ArtifactID(), v,
+				))
+			}
+		}
+	}
+	return validationError(
+		fmt.Sprintf("java modules not set to version %s", version), problems,
+	)
+}
@@ -0,0 +1,141 @@
+package release
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testParentPom = `<?xml version="1.0" encoding="UTF-8"?>
+<project xmlns="http://maven.apache.org/POM/4.0.0">
+  <modelVersion>4.0.0</modelVersion>
+  <!-- The vitess parent -->
+  <groupId>io.vitess</groupId>
+  <artifactId>vitess-parent</artifactId>
+  <version>12.0.4-SNAPSHOT</version>
+  <packaging>pom</packaging>
+
+  <parent>
+    <groupId>org.sonatype.oss</groupId>
+    <artifactId>oss-parent</artifactId>
+    <version>7</version>
+  </parent>
+
+  <dependencyManagement>
+    <dependencies>
+      <dependency>
+        <groupId>io.vitess</groupId>
+        <artifactId>vitess-client</artifactId>
+        <version>${project.version}</version>
+      </dependency>
+      <dependency>
+        <groupId>io.grpc</groupId>
+        <artifactId>grpc-core</artifactId>
+        <version>1.40.0</version>
+      </dependency>
+    </dependencies>
+  </dependencyManagement>
+</project>
+`
+
+const testClientPom = `<?xml version="1.0" encoding="UTF-8"?>
+<project>
+	<parent>
+		<groupId>io.vitess</groupId>
+		<artifactId>vitess-parent</artifactId>
+		<version>
+			12.0.4-SNAPSHOT
+		</version>
+		<relativePath>../pom.xml</relativePath>
+	</parent>
+	<artifactId>vitess-client</artifactId>
+</project>
+`
+
+const testJDBCPom = `<?xml version="1.0" encoding="UTF-8"?>
+<project>
+  <parent>
+    <groupId>io.vitess</groupId>
+    <artifactId>vitess-parent</artifactId>
+    <version>12.0.4-SNAPSHOT</version>
+  </parent>
+  <artifactId>vitess-jdbc</artifactId>
+  <version>12.0.4-SNAPSHOT</version>
+  <dependencies>
+    <dependency>
+      <artifactId>vitess-client</artifactId>
+      <version>12.0.4-SNAPSHOT</version>
+      <groupId>io.vitess</groupId>
+    </dependency>
+  </dependencies>
+</project>
+`
+
+// newTestJavaRepo writes the java modules to a temporary directory
+func newTestJavaRepo(t *testing.T, poms map[string]string) string {
+	dir := t.TempDir()
+	for path, content := range poms {
+		path = filepath.Join(dir, "java", path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), os.FileMode(0o755)))
+		require.NoError(t, os.WriteFile(path, []byte(content), os.FileMode(0o644)))
+	}
+	return dir
+}
+
+func TestSetJavaVersion(t *testing.T) {
+	dir := newTestJavaRepo(t, map[string]string{
+		"pom.xml":               testParentPom,
+		"client/pom.xml":        testClientPom,
+		"jdbc/pom.xml":          testJDBCPom,
+		"client/target/pom.xml": "not xml",
+	})
+
+	require.NoError(t, setJavaVersion(dir, "v12.0.4"))
+	for path, expected := range map[string]string{
+		// Only the versions of the vitess modules change
+		"pom.xml": strings.Replace(testParentPom,
+			"<version>12.0.4-SNAPSHOT</version>", "<version>12.0.4</version>", 1),
+		"client/pom.xml": strings.Replace(testClientPom,
+			"\t\t\t12.0.4-SNAPSHOT\n", "\t\t\t12.0.4\n", 1),
+		"jdbc/pom.xml": strings.ReplaceAll(testJDBCPom, "12.0.4-SNAPSHOT", "12.0.4"),
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, "java", path))
+		require.NoError(t, err)
+		require.Equal(t, expected, string(data), path)
+	}
+
+	// Back to dev mode
+	require.NoError(t, setJavaVersion(dir, "v12.0.5-SNAPSHOT"))
+	require.NoError(t, verifyJavaVersion(dir, "12.0.5-SNAPSHOT"))
+	require.Error(t, verifyJavaVersion(dir, "v12.0.4"))
+	require.Error(t, setJavaVersion(dir, ""))
+}
+
+func TestVerifyJavaVersion(t *testing.T) {
+	// A module with a parent outside of the reactor keeps its version
+	dir := newTestJavaRepo(t, map[string]string{
+		"pom.xml": testParentPom,
+		"example/pom.xml": `<project>
+  <parent>
+    <groupId>io.vitess.examples</groupId>
+    <artifactId>examples-parent</artifactId>
+    <version>1.0</version>
+  </parent>
+  <artifactId>vitess-example</artifactId>
+</project>
+`,
+	})
+	err := setJavaVersion(dir, "v12.0.4")
+	require.Error(t, err)
+	require.Equal(t,
+		"java modules not set to version 12.0.4:\n  - "+
+			filepath.Join("java", "example", "pom.xml")+` (vitess-example) has version "1.0"`,
+		err.Error(),
+	)
+
+	// No java modules
+	require.Error(t, verifyJavaVersion(t.TempDir(), "v12.0.4"))
+}
@@ -0,0 +1,28 @@
+package release
+
+// ImageDigest records an image variant pushed by the build
+type ImageDigest struct {
+	// Name of the image and debian version of the variant
+	Image  string `json:"image"`
+	Distro string `json:"distro"`
+
+	// Repository the image was pushed to
+	Repository string `json:"repository"`
+
+	// Digest of the multi-arch index and the tags pointing to it
+	Digest string   `json:"digest"`
+	Tags   []string `json:"tags"`
+
+	// Platforms maps each platform (os/arch[/variant]) to the digest
+	// of its image in the index
+	Platforms map[string]string `json:"platforms"`
+}
+
+// ReleaseManifest lists the artifacts of a release pinned by digest
+type ReleaseManifest struct {
+	Version string        `json:"version"`
+	Images  []ImageDigest `json:"images"`
+}
+
+// releaseManifestFile is the name of the manifest in the artifacts dir
+const releaseManifestFile = "release-manifest.json"
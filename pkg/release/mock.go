@@ -0,0 +1,26 @@
+package release
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// mockRecorder is embedded in the mock implementations to log the
+// actions they skip and keep a list of them. Builds run in parallel, so
+// the actions are recorded under a lock.
+type mockRecorder struct {
+	mtx     sync.Mutex
+	actions []string
+}
+
+// record logs an action the mock would have performed and appends it
+// to the list of actions
+func (mr *mockRecorder) record(format string, args ...interface{}) {
+	action := fmt.Sprintf(format, args...)
+	logrus.Infof("  🧪 [mock] Would %s", action)
+	mr.mtx.Lock()
+	defer mr.mtx.Unlock()
+	mr.actions = append(mr.actions, action)
+}
@@ -0,0 +1,65 @@
+package release
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// PackageFormats are the distro package formats built for a release
+var PackageFormats = []string{"deb", "rpm"}
+
+// Packages builds the distro packages of the binaries in the tarballs
+// written by Binaries, for each platform, and writes their checksums to
+// the artifacts directory. Returns the package paths.
+func (b *Build) Packages() ([]string, error) {
+	if err := b.impl.ValidateBinariesOpts(&b.Options, &b.State); err != nil {
+		return nil, errors.Wrap(err, "validating package build options")
+	}
+
+	commit, err := b.impl.SourceCommit(&b.Options, &b.State)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.MkdirTemp("", "vtrelease-packages-")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating temporary directory")
+	}
+	defer os.RemoveAll(tmp)
+
+	packages := []string{}
+	for _, platform := range b.Options.Platforms {
+		tarball := filepath.Join(
+			binariesDir(&b.Options),
+			binariesPackageName(b.Options.VTBaseVersion, commit, platform)+".tar.gz",
+		)
+		binDir, err := b.impl.ExtractBinaries(
+			&b.Options, &b.State, tarball, filepath.Join(tmp, strings.ReplaceAll(platform, "/", "-")),
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "extracting binaries for %s", platform)
+		}
+		for _, format := range PackageFormats {
+			logrus.Infof("📦 Building %s package of vitess %s for %s", format, b.Options.VTBaseVersion, platform)
+			pkg, err := b.impl.BuildPackage(&b.Options, &b.State, format, b.Options.VTBaseVersion, platform, binDir)
+			if err != nil {
+				return nil, errors.Wrapf(err, "building %s package for %s", format, platform)
+			}
+			packages = append(packages, pkg)
+		}
+	}
+
+	if err := b.impl.WriteChecksums(&b.Options, packagesDir(&b.Options), packages); err != nil {
+		return nil, errors.Wrap(err, "writing checksums")
+	}
+	return packages, nil
+}
+
+// packagesDir returns the directory where the packages are written
+func packagesDir(o *BuildOptions) string {
+	return filepath.Join(o.ArtifactsDir, "packages")
+}
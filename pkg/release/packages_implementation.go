@@ -0,0 +1,162 @@
+package release
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goreleaser/nfpm/v2"
+	_ "github.com/goreleaser/nfpm/v2/deb" // register the deb packager
+	"github.com/goreleaser/nfpm/v2/files"
+	_ "github.com/goreleaser/nfpm/v2/rpm" // register the rpm packager
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/release-utils/util"
+)
+
+// Metadata of the vitess distro packages
+const (
+	packageName        = "vitess"
+	packageMaintainer  = "Vitess Maintainers <cncf-vitess-maintainers@lists.cncf.io>"
+	packageVendor      = "The Vitess Authors"
+	packageHomepage    = "https://vitess.io"
+	packageLicense     = "Apache-2.0"
+	packageDescription = "Vitess is a database clustering system for horizontal scaling of MySQL."
+)
+
+// ExtractBinaries extracts a binaries tarball into dest and returns the
+// directory with its contents
+func (di *defaultBuildImplementation) ExtractBinaries(o *BuildOptions, s *State, tarball, dest string) (string, error) {
+	f, err := os.Open(tarball)
+	if err != nil {
+		return "", errors.Wrap(err, "opening binaries tarball, were the binaries built?")
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return "", errors.Wrapf(err, "reading %s", tarball)
+	}
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "reading %s", tarball)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		path := filepath.Join(dest, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dest)+string(filepath.Separator)) {
+			return "", errors.Errorf("invalid path %s in tarball", hdr.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), os.FileMode(0o755)); err != nil {
+			return "", errors.Wrap(err, "creating directory")
+		}
+		out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode().Perm())
+		if err != nil {
+			return "", errors.Wrapf(err, "creating %s", path)
+		}
+		if _, err := io.Copy(out, tr); err != nil {
+			out.Close()
+			return "", errors.Wrapf(err, "extracting %s", path)
+		}
+		if err := out.Close(); err != nil {
+			return "", errors.Wrapf(err, "extracting %s", path)
+		}
+	}
+	return filepath.Join(dest, strings.TrimSuffix(filepath.Base(tarball), ".tar.gz")), nil
+}
+
+// BuildPackage writes a deb or rpm package with the binaries in binDir
+// to the artifacts directory. Binaries are installed in /usr/bin and the
+// license and readme in /usr/share/doc/vitess. No service units are
+// shipped.
+func (di *defaultBuildImplementation) BuildPackage(
+	o *BuildOptions, s *State, format, version, platform, binDir string,
+) (string, error) {
+	packager, err := nfpm.Get(format)
+	if err != nil {
+		return "", errors.Wrapf(err, "getting %s packager", format)
+	}
+	info, err := packageInfo(version, platform, binDir)
+	if err != nil {
+		return "", err
+	}
+
+	dir := packagesDir(o)
+	if err := os.MkdirAll(dir, os.FileMode(0o755)); err != nil {
+		return "", errors.Wrap(err, "creating packages directory")
+	}
+	path := filepath.Join(dir, packager.ConventionalFileName(info))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "creating %s", path)
+	}
+	defer f.Close()
+	if err := packager.Package(info, f); err != nil {
+		return "", errors.Wrapf(err, "writing %s", path)
+	}
+	logrus.Infof("📦 Wrote %s", path)
+	return path, errors.Wrapf(f.Close(), "closing %s", path)
+}
+
+// packageInfo returns the package definition for the binaries in binDir
+func packageInfo(version, platform, binDir string) (*nfpm.Info, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 {
+		return nil, errors.Errorf("invalid platform %q", platform)
+	}
+
+	contents := files.Contents{}
+	entries, err := os.ReadDir(filepath.Join(binDir, "bin"))
+	if err != nil {
+		return nil, errors.Wrap(err, "reading binaries")
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		contents = append(contents, &files.Content{
+			Source:      filepath.Join(binDir, "bin", entry.Name()),
+			Destination: "/usr/bin/" + entry.Name(),
+			FileInfo:    &files.ContentFileInfo{Mode: 0o755},
+		})
+	}
+	if len(contents) == 0 {
+		return nil, errors.Errorf("no binaries found in %s", binDir)
+	}
+	for _, doc := range []string{"LICENSE", "README.md"} {
+		if util.Exists(filepath.Join(binDir, doc)) {
+			contents = append(contents, &files.Content{
+				Source:      filepath.Join(binDir, doc),
+				Destination: "/usr/share/doc/vitess/" + doc,
+				FileInfo:    &files.ContentFileInfo{Mode: 0o644},
+			})
+		}
+	}
+
+	info := nfpm.WithDefaults(&nfpm.Info{
+		Name:        packageName,
+		Arch:        parts[1],
+		Platform:    parts[0],
+		Version:     strings.TrimPrefix(version, "v"),
+		Release:     "1",
+		Section:     "database",
+		Priority:    "optional",
+		Maintainer:  packageMaintainer,
+		Description: packageDescription,
+		Vendor:      packageVendor,
+		Homepage:    packageHomepage,
+		License:     packageLicense,
+		Overridables: nfpm.Overridables{
+			Contents: contents,
+		},
+	})
+	return info, errors.Wrap(nfpm.Validate(info), "validating package definition")
+}
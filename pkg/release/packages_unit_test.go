@@ -0,0 +1,135 @@
+package release
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// debFiles lists the files installed by a deb package
+func debFiles(t *testing.T, path string) []string {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(data, []byte("!<arch>\n")))
+	data = data[8:]
+	for len(data) >= 60 {
+		name := strings.TrimSpace(string(data[:16]))
+		size, err := strconv.Atoi(strings.TrimSpace(string(data[48:58])))
+		require.NoError(t, err)
+		member := data[60 : 60+size]
+		data = data[60+size+size%2:]
+		if name != "data.tar.gz" {
+			continue
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(member))
+		require.NoError(t, err)
+		tr := tar.NewReader(zr)
+		files := []string{}
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return files
+			}
+			require.NoError(t, err)
+			if hdr.Typeflag == tar.TypeReg {
+				files = append(files, hdr.Name)
+			}
+		}
+	}
+	t.Fatalf("no data.tar.gz found in %s", path)
+	return nil
+}
+
+func TestBuildPackages(t *testing.T) {
+	repoPath, commit := newTestGoRepo(t, "v12.0.4")
+	opts := DefaultBuildOptions
+	opts.RepoPath = repoPath
+	opts.VTBaseVersion = "v12.0.4"
+	opts.ArtifactsDir = t.TempDir()
+	opts.NoMock = true
+
+	// Packages are built from the binaries tarballs
+	_, err := NewBuild(opts).Packages()
+	require.Error(t, err)
+
+	bin := t.TempDir()
+	for path, content := range map[string]string{
+		"vtgate":    "\x7fELF vtgate",
+		"vttablet":  "\x7fELF vttablet",
+		"LICENSE":   "Apache License\n",
+		"README.md": "# Vitess\n",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(bin, path), []byte(content), os.FileMode(0o755)))
+	}
+	require.NoError(t, os.MkdirAll(binariesDir(&opts), os.FileMode(0o755)))
+	for _, platform := range opts.Platforms {
+		name := binariesPackageName(opts.VTBaseVersion, commit, platform)
+		require.NoError(t, writeTarball(filepath.Join(binariesDir(&opts), name+".tar.gz"), name, map[string]string{
+			"bin/vtgate":   filepath.Join(bin, "vtgate"),
+			"bin/vttablet": filepath.Join(bin, "vttablet"),
+			"LICENSE":      filepath.Join(bin, "LICENSE"),
+			"README.md":    filepath.Join(bin, "README.md"),
+		}))
+	}
+
+	// The version to package is read from the stage state
+	staged := opts
+	staged.VTBaseVersion = ""
+	staged.StateFile = filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, saveState(staged.StateFile, &State{
+		Branch: "release-12.0", Version: "v12.0.4", ReleasePoint: commit, NoMock: true,
+		Steps: []string{stepPrepareEnvironment, stepReleaseNotes, stepTagRepository},
+	}))
+	sut := NewBuild(staged)
+	require.NoError(t, sut.LoadState())
+	packages, err := sut.Packages()
+	require.NoError(t, err)
+	dir := filepath.Join(opts.ArtifactsDir, "packages")
+	require.Equal(t, []string{
+		filepath.Join(dir, "vitess_12.0.4-1_amd64.deb"),
+		filepath.Join(dir, "vitess-12.0.4-1.x86_64.rpm"),
+		filepath.Join(dir, "vitess_12.0.4-1_arm64.deb"),
+		filepath.Join(dir, "vitess-12.0.4-1.aarch64.rpm"),
+	}, packages)
+
+	require.ElementsMatch(t, []string{
+		"./usr/bin/vtgate", "./usr/bin/vttablet",
+		"./usr/share/doc/vitess/LICENSE", "./usr/share/doc/vitess/README.md",
+	}, debFiles(t, packages[0]))
+
+	rpm, err := os.ReadFile(packages[1])
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(rpm, []byte{0xed, 0xab, 0xee, 0xdb}))
+	for _, s := range []string{"/usr/bin/", "vtgate", "vttablet", "/usr/share/doc/vitess/", "12.0.4"} {
+		require.Contains(t, string(rpm), s)
+	}
+
+	sums, err := os.ReadFile(filepath.Join(dir, checksumsFile))
+	require.NoError(t, err)
+	require.Len(t, strings.Split(strings.TrimSpace(string(sums)), "\n"), 4)
+
+	// Release candidates sort before the final version
+	rcDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(rcDir, "bin"), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(rcDir, "bin", "vtgate"), []byte("vtgate"), os.FileMode(0o755)))
+	info, err := packageInfo("v13.0.0-rc1", "linux/amd64", rcDir)
+	require.NoError(t, err)
+	require.Equal(t, "13.0.0", info.Version)
+	require.Equal(t, "rc1", info.Prerelease)
+	deb, err := nfpm.Get("deb")
+	require.NoError(t, err)
+	require.Equal(t, "vitess_13.0.0~rc1-1_amd64.deb", deb.ConventionalFileName(info))
+
+	// Directories without binaries cannot be packaged
+	_, err = packageInfo("v13.0.0", "linux/amd64", t.TempDir())
+	require.Error(t, err)
+}
@@ -0,0 +1,57 @@
+package release
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Plan describes what a stage run will do
+type Plan struct {
+	Branch           string   `json:"branch"`
+	CurrentCommit    string   `json:"currentCommit"`
+	PreviousVersion  string   `json:"previousVersion"`
+	Version          string   `json:"version"`
+	DevVersion       string   `json:"devVersion"`
+	GoDocVersion     string   `json:"goDocVersion,omitempty"`
+	ReleaseNotesPath string   `json:"releaseNotesPath"`
+	Files            []string `json:"files"`
+	Commits          []string `json:"commits"`
+	Tags             []string `json:"tags"`
+}
+
+// WriteText writes the plan in human readable form to w
+func (p *Plan) WriteText(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Release plan for %s\n\n", p.Version)
+	for _, field := range [][2]string{
+		{"Branch", p.Branch},
+		{"Current commit", p.CurrentCommit},
+		{"Previous version", p.PreviousVersion},
+		{"Next version", p.Version},
+		{"Dev version", p.DevVersion},
+		{"GoDoc tag", p.GoDocVersion},
+		{"Release notes", p.ReleaseNotesPath},
+	} {
+		if field[1] == "" {
+			field[1] = "(none)"
+		}
+		fmt.Fprintf(&sb, "  %-17s %s\n", field[0]+":", field[1])
+	}
+
+	for _, list := range []struct {
+		title string
+		items []string
+	}{
+		{"Files to modify", p.Files},
+		{"Commits to create", p.Commits},
+		{"Tags to create", p.Tags},
+	} {
+		fmt.Fprintf(&sb, "\n%s:\n", list.title)
+		for _, item := range list.items {
+			fmt.Fprintf(&sb, "  - %s\n", item)
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
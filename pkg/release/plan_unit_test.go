@@ -0,0 +1,84 @@
+package release
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanWriteText(t *testing.T) {
+	plan := &Plan{
+		Branch:           "release-12.0",
+		CurrentCommit:    "7a8c5b1",
+		PreviousVersion:  "v12.0.3",
+		Version:          "v12.0.4",
+		DevVersion:       "v12.0.5-SNAPSHOT",
+		ReleaseNotesPath: "doc/releasenotes/12_0_4_release_notes.md",
+		Files:            []string{versionFile, "java/pom.xml"},
+		Commits:          []string{"Release commit for v12.0.4", "Back to dev mode"},
+		Tags:             []string{"v12.0.4"},
+	}
+	var sb strings.Builder
+	require.NoError(t, plan.WriteText(&sb))
+	out := sb.String()
+	require.Contains(t, out, "Release plan for v12.0.4")
+	require.Contains(t, out, "Previous version: v12.0.3")
+	require.Contains(t, out, "GoDoc tag:        (none)")
+	require.Contains(t, out, "  - java/pom.xml\n")
+	require.Contains(t, out, "Tags to create:\n  - v12.0.4\n")
+}
+
+func TestStagePlan(t *testing.T) {
+	dir := newTestRepo(t).Dir()
+	runGit(t, dir, "tag", "v12.0.3")
+	for _, pom := range []string{"java/pom.xml", "java/client/pom.xml", "java/client/target/pom.xml"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(pom)), os.FileMode(0o755)))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, pom), []byte("<project/>\n"), os.FileMode(0o644)))
+	}
+	runGit(t, dir, "add", "java")
+	runGit(t, dir, "commit", "-m", "Add java modules")
+	head := strings.TrimSpace(runGit(t, dir, "rev-parse", "HEAD"))
+
+	mock := &mockStageImplementation{}
+	sut := &Stage{
+		impl: mock,
+		Options: StageOptions{
+			RepoPath: dir, Branch: "release-12.0", ReleaseType: ReleaseTypePatch, GoDocVersion: "v0.12.4",
+		},
+	}
+	plan, err := sut.Plan()
+	require.NoError(t, err)
+	require.Equal(t, &Plan{
+		Branch:           "release-12.0",
+		CurrentCommit:    head,
+		PreviousVersion:  "v12.0.3",
+		Version:          "v12.0.4",
+		DevVersion:       "v12.0.5-SNAPSHOT",
+		GoDocVersion:     "v0.12.4",
+		ReleaseNotesPath: "doc/releasenotes/12_0_4_release_notes.md",
+		Files: []string{
+			versionFile, "doc/releasenotes/12_0_4_release_notes.md",
+			"java/client/pom.xml", "java/pom.xml",
+		},
+		Commits: []string{"Release commit for v12.0.4", "Back to dev mode"},
+		Tags:    []string{"v12.0.4", "v0.12.4"},
+	}, plan)
+
+	// Planning does not touch the repository
+	require.Empty(t, mock.actions)
+	require.Empty(t, runGit(t, dir, "status", "--porcelain"))
+	require.Equal(t, "v12.0.3\n", runGit(t, dir, "tag"))
+
+	data, err := json.Marshal(plan)
+	require.NoError(t, err)
+	decoded := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, "v12.0.4", decoded["version"])
+	require.Equal(t, "v12.0.3", decoded["previousVersion"])
+	require.Equal(t, "doc/releasenotes/12_0_4_release_notes.md", decoded["releaseNotesPath"])
+	require.Equal(t, []interface{}{"v12.0.4", "v0.12.4"}, decoded["tags"])
+}
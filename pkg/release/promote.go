@@ -0,0 +1,219 @@
+package release
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type PromoteImplementation interface {
+	DiscoverImages(*PromoteOptions) ([]string, error)
+	ListTags(*PromoteOptions, string) ([]string, error)
+	ResolveDigest(*PromoteOptions, string) (string, error)
+	PlatformDigests(*PromoteOptions, string) ([]string, error)
+	CopyImage(*PromoteOptions, string, string) error
+	VerifyDigest(*PromoteOptions, string, string) error
+}
+
+type PromoteOptions struct {
+	// Path to vitess repository, used to discover the images
+	RepoPath string
+
+	// Version whose images will be promoted, eg v12.0.4
+	Version string
+
+	// Registry where images are staged
+	StagingRegistry string
+
+	// Registry where images are promoted to
+	ProductionRegistry string
+
+	// Images to promote. If empty, all images in the repo are promoted
+	Images []string
+
+	// NoMock copies the staged images to the production registry. Left
+	// unset, the tags to promote are resolved and listed without copying.
+	NoMock bool
+}
+
+var DefaultPromoteOptions = PromoteOptions{
+	StagingRegistry: DefaultBuildOptions.StagingRegistry,
+}
+
+func (o *PromoteOptions) Validate() error {
+	problems := []string{}
+	if o.Version == "" {
+		problems = append(problems, "version to promote not defined")
+	}
+	for _, reg := range []struct{ name, value string }{
+		{"staging", o.StagingRegistry},
+		{"production", o.ProductionRegistry},
+	} {
+		if _, err := name.NewRepository(reg.value, name.StrictValidation); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid %s registry %q: %v", reg.name, reg.value, err))
+		}
+	}
+	if o.StagingRegistry == o.ProductionRegistry {
+		problems = append(problems, "staging and production registries are the same")
+	}
+	return validationError("invalid promotion options", problems)
+}
+
+// PromotedImage records an image tag copied to production
+type PromotedImage struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Digest      string `json:"digest"`
+}
+
+// Promote copies the staged images of a release to the production
+// registry by digest, without rebuilding them
+type Promote struct {
+	Options PromoteOptions
+	impl    PromoteImplementation
+}
+
+func NewPromote(o PromoteOptions) *Promote {
+	var impl PromoteImplementation = &mockPromoteImplementation{}
+	if o.NoMock {
+		impl = &defaultPromoteImplementation{}
+	}
+	return &Promote{
+		impl:    impl,
+		Options: o,
+	}
+}
+
+// Run promotes every staged tag of the version and verifies the
+// digests in the production registry match the staged ones
+func (p *Promote) Run() ([]PromotedImage, error) {
+	if err := p.Options.Validate(); err != nil {
+		return nil, err
+	}
+
+	images := p.Options.Images
+	if len(images) == 0 {
+		var err error
+		images, err = p.impl.DiscoverImages(&p.Options)
+		if err != nil {
+			return nil, errors.Wrap(err, "discovering images")
+		}
+	}
+
+	promoted := []PromotedImage{}
+	for _, image := range images {
+		imagePromotions, err := p.PromoteImage(image)
+		if err != nil {
+			return promoted, errors.Wrapf(err, "promoting image %s", image)
+		}
+		promoted = append(promoted, imagePromotions...)
+	}
+	return promoted, nil
+}
+
+// PromoteImage promotes the tags of one image. Tags of the version and
+// its debian variants are always promoted. Other tags, like the floating
+// latest or MAJOR tags, are promoted only if they point to one of the
+// version digests. The signatures, attestations and SBOMs attached to
+// the promoted images and their platform images are copied along.
+func (p *Promote) PromoteImage(image string) ([]PromotedImage, error) {
+	src := fmt.Sprintf("%s/%s", p.Options.StagingRegistry, image)
+	dst := fmt.Sprintf("%s/%s", p.Options.ProductionRegistry, image)
+
+	tags, err := p.impl.ListTags(&p.Options, src)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing staged tags")
+	}
+
+	digests := map[string]string{}
+	versionDigests := map[string]bool{}
+	for _, tag := range tags {
+		if !isVersionTag(tag, p.Options.Version) {
+			continue
+		}
+		digest, err := p.impl.ResolveDigest(&p.Options, src+":"+tag)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolving digest of %s:%s", src, tag)
+		}
+		digests[tag] = digest
+		versionDigests[digest] = true
+	}
+	if len(digests) == 0 {
+		return nil, errors.Errorf("no tags of version %s staged in %s", p.Options.Version, src)
+	}
+
+	for _, tag := range tags {
+		if _, ok := digests[tag]; ok {
+			continue
+		}
+		digest, err := p.impl.ResolveDigest(&p.Options, src+":"+tag)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolving digest of %s:%s", src, tag)
+		}
+		if versionDigests[digest] {
+			digests[tag] = digest
+		}
+	}
+
+	// Artifacts attached to the promoted digests follow their images
+	attachedDigests := map[string]bool{}
+	for digest := range versionDigests {
+		attachedDigests[digest] = true
+		platformDigests, err := p.impl.PlatformDigests(&p.Options, src+"@"+digest)
+		if err != nil {
+			return nil, errors.Wrapf(err, "listing platform images of %s@%s", src, digest)
+		}
+		for _, d := range platformDigests {
+			attachedDigests[d] = true
+		}
+	}
+	for _, tag := range tags {
+		digest, ok := attachedTagDigest(tag)
+		if !ok || !attachedDigests[digest] {
+			continue
+		}
+		artifactsDigest, err := p.impl.ResolveDigest(&p.Options, src+":"+tag)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolving digest of %s:%s", src, tag)
+		}
+		digests[tag] = artifactsDigest
+	}
+
+	promoted := []PromotedImage{}
+	for _, tag := range tags {
+		digest, ok := digests[tag]
+		if !ok {
+			continue
+		}
+		promotion := PromotedImage{
+			Source:      fmt.Sprintf("%s@%s", src, digest),
+			Destination: fmt.Sprintf("%s:%s", dst, tag),
+			Digest:      digest,
+		}
+		logrus.Infof("🚚 Promoting %s to %s", promotion.Source, promotion.Destination)
+		if err := p.impl.CopyImage(&p.Options, promotion.Source, promotion.Destination); err != nil {
+			return promoted, errors.Wrapf(err, "copying %s", promotion.Source)
+		}
+		if err := p.impl.VerifyDigest(&p.Options, promotion.Destination, digest); err != nil {
+			return promoted, errors.Wrapf(err, "verifying %s", promotion.Destination)
+		}
+		promoted = append(promoted, promotion)
+	}
+	return promoted, nil
+}
+
+// isVersionTag returns true if tag is the version or one of its
+// debian variants. Release candidates of a GA version do not match.
+func isVersionTag(tag, version string) bool {
+	if tag == version {
+		return true
+	}
+	for _, distro := range KnownDebianVersions {
+		if tag == version+"-"+distro {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package release
+
+import (
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/pkg/errors"
+)
+
+type defaultPromoteImplementation struct{}
+
+// DiscoverImages returns the images that are built from the repository
+func (di *defaultPromoteImplementation) DiscoverImages(o *PromoteOptions) ([]string, error) {
+	return (&defaultBuildImplementation{}).DiscoverImages(&BuildOptions{RepoPath: o.RepoPath})
+}
+
+// ListTags lists the tags of an image repository
+func (di *defaultPromoteImplementation) ListTags(o *PromoteOptions, repository string) ([]string, error) {
+	return listTags(repository)
+}
+
+// ResolveDigest returns the digest a reference points to
+func (di *defaultPromoteImplementation) ResolveDigest(o *PromoteOptions, refString string) (string, error) {
+	return resolveDigest(refString)
+}
+
+// PlatformDigests returns the digests of the platform images in the
+// index refString points to. A single image has no platform images.
+func (di *defaultPromoteImplementation) PlatformDigests(o *PromoteOptions, refString string) ([]string, error) {
+	ref, err := name.ParseReference(refString)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing reference")
+	}
+	desc, err := remote.Get(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching descriptor of %s", refString)
+	}
+	if !desc.MediaType.IsIndex() {
+		return nil, nil
+	}
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading index")
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading index manifest")
+	}
+	digests := []string{}
+	for _, m := range manifest.Manifests {
+		digests = append(digests, m.Digest.String())
+	}
+	return digests, nil
+}
+
+// CopyImage copies an image or index with all its blobs from src to dst
+func (di *defaultPromoteImplementation) CopyImage(o *PromoteOptions, src, dst string) error {
+	srcRef, err := name.ParseReference(src)
+	if err != nil {
+		return errors.Wrap(err, "parsing source reference")
+	}
+	dstRef, err := name.ParseReference(dst)
+	if err != nil {
+		return errors.Wrap(err, "parsing destination reference")
+	}
+	auth := remote.WithAuthFromKeychain(authn.DefaultKeychain)
+
+	desc, err := remote.Get(srcRef, auth)
+	if err != nil {
+		return errors.Wrap(err, "fetching source descriptor")
+	}
+
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return errors.Wrap(err, "reading source index")
+		}
+		return errors.Wrap(remote.WriteIndex(dstRef, idx, auth), "writing index")
+	}
+
+	img, err := desc.Image()
+	if err != nil {
+		return errors.Wrap(err, "reading source image")
+	}
+	return errors.Wrap(remote.Write(dstRef, img, auth), "writing image")
+}
+
+// VerifyDigest checks that a reference points to the expected digest
+func (di *defaultPromoteImplementation) VerifyDigest(o *PromoteOptions, refString, digest string) error {
+	actual, err := resolveDigest(refString)
+	if err != nil {
+		return err
+	}
+	if actual != digest {
+		return errors.Errorf("%s has digest %s, expected %s", refString, actual, digest)
+	}
+	return nil
+}
+
+// listTags returns the tags in a remote image repository
+func listTags(repository string) ([]string, error) {
+	repo, err := name.NewRepository(repository)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing repository")
+	}
+	return remote.List(repo, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+}
+
+// resolveDigest returns the digest a remote reference points to
+func resolveDigest(refString string) (string, error) {
+	ref, err := name.ParseReference(refString)
+	if err != nil {
+		return "", errors.Wrap(err, "parsing reference")
+	}
+	desc, err := remote.Head(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return "", errors.Wrapf(err, "fetching descriptor of %s", refString)
+	}
+	return desc.Digest.String(), nil
+}
@@ -0,0 +1,20 @@
+package release
+
+// mockPromoteImplementation reads the staged images but only logs the
+// copies to the production registry
+type mockPromoteImplementation struct {
+	defaultPromoteImplementation
+	mockRecorder
+}
+
+// CopyImage logs the copy that would be made
+func (mi *mockPromoteImplementation) CopyImage(o *PromoteOptions, src, dst string) error {
+	mi.record("copy %s to %s", src, dst)
+	return nil
+}
+
+// VerifyDigest logs the digest that would be verified
+func (mi *mockPromoteImplementation) VerifyDigest(o *PromoteOptions, ref, digest string) error {
+	mi.record("verify %s has digest %s", ref, digest)
+	return nil
+}
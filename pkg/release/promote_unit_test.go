@@ -0,0 +1,122 @@
+package release
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromote(t *testing.T) {
+	reg := newTestRegistry(t)
+	staging := reg + "/staging"
+	production := reg + "/vitess"
+
+	platforms := []v1.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64"},
+	}
+	release := pushTestIndex(t, staging+"/vtgate:v12.0.4-buster", platforms...)
+	releaseDigest, err := release.Digest()
+	require.NoError(t, err)
+	for _, tag := range []string{"v12.0.4", "latest"} {
+		ref, err := name.ParseReference(staging + "/vtgate:" + tag)
+		require.NoError(t, err)
+		require.NoError(t, remote.WriteIndex(ref, release))
+	}
+	bullseye := pushTestIndex(t, staging+"/vtgate:v12.0.4-bullseye", platforms...)
+	bullseyeDigest, err := bullseye.Digest()
+	require.NoError(t, err)
+	// Older releases and floating tags of other versions stay in staging
+	older := pushTestIndex(t, staging+"/vtgate:v12.0.3", platforms...)
+	pushTestIndex(t, staging+"/vtgate:latest-bullseye", platforms...)
+	pushTestIndex(t, staging+"/vtgate:v12.0.4-rc1", platforms...)
+
+	// Artifacts attached to the release index and its platform images
+	// are promoted, those of other versions are not
+	releaseManifest, err := release.IndexManifest()
+	require.NoError(t, err)
+	olderDigest, err := older.Digest()
+	require.NoError(t, err)
+	stagingRepo, err := name.NewRepository(staging + "/vtgate")
+	require.NoError(t, err)
+	attached := map[string]string{}
+	for _, a := range []struct {
+		digest   v1.Hash
+		suffix   string
+		promoted bool
+	}{
+		{releaseDigest, signatureTagSuffix, true},
+		{releaseManifest.Manifests[0].Digest, sbomTagSuffix, true},
+		{olderDigest, signatureTagSuffix, false},
+	} {
+		tag, err := attachedTag(stagingRepo.Digest(a.digest.String()), a.suffix)
+		require.NoError(t, err)
+		require.NoError(t, attachLayer(tag, static.NewLayer([]byte(a.suffix), "text/plain"), nil, nil))
+		if a.promoted {
+			attached[tag.TagStr()], err = resolveDigest(tag.String())
+			require.NoError(t, err)
+		}
+	}
+
+	opts := PromoteOptions{
+		Version:            "v12.0.4",
+		StagingRegistry:    staging,
+		ProductionRegistry: production,
+		Images:             []string{"vtgate"},
+	}
+
+	// Mock mode resolves the images but does not copy them
+	mock := NewPromote(opts)
+	promoted, err := mock.Run()
+	require.NoError(t, err)
+	require.Len(t, promoted, 6)
+	dst, err := name.NewRepository(production + "/vtgate")
+	require.NoError(t, err)
+	_, err = remote.List(dst)
+	require.Error(t, err)
+
+	opts.NoMock = true
+	promoted, err = NewPromote(opts).Run()
+	require.NoError(t, err)
+
+	expected := map[string]string{
+		"latest":           releaseDigest.String(),
+		"v12.0.4":          releaseDigest.String(),
+		"v12.0.4-buster":   releaseDigest.String(),
+		"v12.0.4-bullseye": bullseyeDigest.String(),
+	}
+	for tag, digest := range attached {
+		expected[tag] = digest
+	}
+	require.Len(t, promoted, len(expected))
+	for _, p := range promoted {
+		ref, err := name.NewTag(p.Destination)
+		require.NoError(t, err)
+		tag := ref.TagStr()
+		require.Equal(t, expected[tag], p.Digest, tag)
+		require.Equal(t, fmt.Sprintf("%s/vtgate@%s", staging, p.Digest), p.Source)
+	}
+
+	tags, err := remote.List(dst)
+	require.NoError(t, err)
+	expectedTags := []string{}
+	for tag := range expected {
+		expectedTags = append(expectedTags, tag)
+	}
+	require.ElementsMatch(t, expectedTags, tags)
+
+	// The platform images are copied along with the index
+	copied, err := imagePlatforms(production + "/vtgate:v12.0.4")
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"linux/amd64": true, "linux/arm64": true}, copied)
+
+	// Versions not staged cannot be promoted
+	opts.Version = "v12.0.5"
+	_, err = NewPromote(opts).Run()
+	require.Error(t, err)
+}
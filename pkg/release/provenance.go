@@ -0,0 +1,173 @@
+package release
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	attestationTagSuffix = "att"
+
+	inTotoStatementType   = "https://in-toto.io/Statement/v0.1"
+	inTotoPayloadType     = "application/vnd.in-toto+json"
+	slsaProvenanceType    = "https://slsa.dev/provenance/v0.2"
+	imageBuildType        = "https://github.com/puerco/vtrelease/image@v1"
+	dsseEnvelopeMediaType = "application/vnd.dsse.envelope.v1+json"
+
+	// predicateTypeAnnotation marks the type of predicate attested in
+	// each layer of the attestations image, as cosign does
+	predicateTypeAnnotation = "predicateType"
+)
+
+type inTotoStatement struct {
+	Type          string              `json:"_type"`
+	PredicateType string              `json:"predicateType"`
+	Subject       []inTotoSubject     `json:"subject"`
+	Predicate     provenancePredicate `json:"predicate"`
+}
+
+type inTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// provenancePredicate is a SLSA v0.2 provenance predicate
+type provenancePredicate struct {
+	Builder struct {
+		ID string `json:"id"`
+	} `json:"builder"`
+	BuildType  string `json:"buildType"`
+	Invocation struct {
+		ConfigSource provenanceMaterial `json:"configSource"`
+		Parameters   map[string]string  `json:"parameters"`
+	} `json:"invocation"`
+	Metadata struct {
+		BuildStartedOn  string `json:"buildStartedOn"`
+		BuildFinishedOn string `json:"buildFinishedOn"`
+		Reproducible    bool   `json:"reproducible"`
+	} `json:"metadata"`
+	Materials []provenanceMaterial `json:"materials"`
+}
+
+type provenanceMaterial struct {
+	URI        string            `json:"uri"`
+	Digest     map[string]string `json:"digest"`
+	EntryPoint string            `json:"entryPoint,omitempty"`
+}
+
+// provenance describes how an image variant was built from the source
+type provenance struct {
+	// Source repository URL and the commit the release tag points to
+	SourceRepository string
+	Tag              string
+	Commit           string
+
+	// Dockerfile used to build the image
+	Dockerfile string
+
+	BuilderID  string
+	BuildArgs  map[string]string
+	StartedOn  time.Time
+	FinishedOn time.Time
+
+	// Subjects of the statement, image references mapped to their
+	// sha256 digests
+	Subjects map[string]string
+}
+
+// Statement returns the in-toto statement with the SLSA provenance
+func (p *provenance) Statement() *inTotoStatement {
+	source := provenanceMaterial{
+		URI:    fmt.Sprintf("git+%s@refs/tags/%s", p.SourceRepository, p.Tag),
+		Digest: map[string]string{"sha1": p.Commit},
+	}
+	statement := &inTotoStatement{
+		Type:          inTotoStatementType,
+		PredicateType: slsaProvenanceType,
+		Subject:       []inTotoSubject{},
+	}
+	for _, subject := range sortedKeys(p.Subjects) {
+		statement.Subject = append(statement.Subject, inTotoSubject{
+			Name: subject, Digest: map[string]string{"sha256": p.Subjects[subject]},
+		})
+	}
+	pred := &statement.Predicate
+	pred.Builder.ID = p.BuilderID
+	pred.BuildType = imageBuildType
+	pred.Invocation.ConfigSource = source
+	pred.Invocation.ConfigSource.EntryPoint = p.Dockerfile
+	pred.Invocation.Parameters = p.BuildArgs
+	pred.Metadata.BuildStartedOn = p.StartedOn.UTC().Format(time.RFC3339)
+	pred.Metadata.BuildFinishedOn = p.FinishedOn.UTC().Format(time.RFC3339)
+	pred.Materials = []provenanceMaterial{source}
+	return statement
+}
+
+type dsseEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+type dsseSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// dssePAE returns the DSSE pre-authentication encoding that is signed
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf(
+		"DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload,
+	))
+}
+
+// signStatement wraps an in-toto statement in a signed DSSE envelope
+func signStatement(key crypto.Signer, statement *inTotoStatement) ([]byte, error) {
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshaling statement")
+	}
+	sig, err := signPayload(key, dssePAE(inTotoPayloadType, payload))
+	if err != nil {
+		return nil, err
+	}
+	envelope, err := json.Marshal(dsseEnvelope{
+		PayloadType: inTotoPayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []dsseSignature{{Sig: sig}},
+	})
+	return envelope, errors.Wrap(err, "marshaling envelope")
+}
+
+// verifyEnvelope checks a DSSE envelope was signed with the key and
+// returns the statement it carries
+func verifyEnvelope(key crypto.PublicKey, data []byte) (*inTotoStatement, error) {
+	envelope := dsseEnvelope{}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, errors.Wrap(err, "parsing envelope")
+	}
+	if envelope.PayloadType != inTotoPayloadType {
+		return nil, errors.Errorf("unexpected payload type %s", envelope.PayloadType)
+	}
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding payload")
+	}
+	verified := false
+	for _, sig := range envelope.Signatures {
+		if verifyPayload(key, dssePAE(envelope.PayloadType, payload), sig.Sig) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("no valid signature found for the key")
+	}
+	statement := &inTotoStatement{}
+	return statement, errors.Wrap(json.Unmarshal(payload, statement), "parsing statement")
+}
@@ -0,0 +1,101 @@
+package release
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttestImage(t *testing.T) {
+	repoPath, commit := newTestImageRepo(t, "v12.0.4")
+
+	reg := newTestRegistry(t) + "/vitess"
+	idx := pushTestIndex(t, reg+"/vtgate:v12.0.4-buster", v1.Platform{OS: "linux", Architecture: "amd64"})
+	digest, err := idx.Digest()
+	require.NoError(t, err)
+
+	keyPath, pubPath := newTestKeyPair(t)
+	opts := DefaultBuildOptions
+	opts.RepoPath = repoPath
+	opts.VTBaseVersion = "v12.0.4"
+	opts.DebianVersions = []string{"buster"}
+	opts.StagingRegistry = reg
+	opts.ArtifactsDir = t.TempDir()
+	opts.SigningKey = keyPath
+
+	started := time.Date(2022, 1, 31, 10, 0, 0, 0, time.UTC)
+	finished := started.Add(10 * time.Minute)
+	impl := &defaultBuildImplementation{}
+	require.NoError(t, impl.AttestImage(&opts, &State{}, "vtgate", started, finished))
+
+	// The attestation is attached to the image digest
+	ref, err := name.NewDigest(reg + "/vtgate@" + digest.String())
+	require.NoError(t, err)
+	tag, err := attachedTag(ref, attestationTagSuffix)
+	require.NoError(t, err)
+	layers, err := attachedLayers(tag)
+	require.NoError(t, err)
+	require.Len(t, layers, 1)
+	require.EqualValues(t, dsseEnvelopeMediaType, layers[0].MediaType)
+	require.Equal(t, slsaProvenanceType, layers[0].Annotations[predicateTypeAnnotation])
+
+	envelope, err := os.ReadFile(filepath.Join(opts.ArtifactsDir, "provenance", "vtgate-v12.0.4-buster.intoto.json"))
+	require.NoError(t, err)
+	require.Equal(t, envelope, layers[0].Content)
+
+	pub, err := LoadPublicKey(pubPath)
+	require.NoError(t, err)
+	statement, err := verifyEnvelope(pub, envelope)
+	require.NoError(t, err)
+	require.Equal(t, []inTotoSubject{{
+		Name: reg + "/vtgate", Digest: map[string]string{"sha256": digest.Hex},
+	}}, statement.Subject)
+
+	pred := statement.Predicate
+	source := "git+https://github.com/vitessio/vitess@refs/tags/v12.0.4"
+	require.Equal(t, source, pred.Invocation.ConfigSource.URI)
+	require.Equal(t, commit, pred.Invocation.ConfigSource.Digest["sha1"])
+	require.Equal(t, "docker/k8s/vtgate/Dockerfile", pred.Invocation.ConfigSource.EntryPoint)
+	require.Equal(t, map[string]string{
+		"VT_BASE_VER": "v12.0.4",
+		"DEBIAN_VER":  "buster-slim",
+		"platforms":   "linux/amd64,linux/arm64",
+	}, pred.Invocation.Parameters)
+	require.Equal(t, "https://github.com/puerco/vtrelease/builders/buildx", pred.Builder.ID)
+	require.Equal(t, "2022-01-31T10:00:00Z", pred.Metadata.BuildStartedOn)
+	require.Equal(t, "2022-01-31T10:10:00Z", pred.Metadata.BuildFinishedOn)
+	require.Equal(t, []provenanceMaterial{{URI: source, Digest: map[string]string{"sha1": commit}}}, pred.Materials)
+
+	// The release point recorded by the stage takes precedence and
+	// attesting again replaces the provenance
+	opts.StateFile = filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, saveState(opts.StateFile, &State{
+		Branch: "release-12.0", Version: "v12.0.4", ReleasePoint: "abc123", NoMock: true,
+		Steps: []string{stepPrepareEnvironment, stepReleaseNotes, stepTagRepository},
+	}))
+	sut := NewBuild(opts)
+	require.NoError(t, sut.LoadState())
+	require.NoError(t, impl.AttestImage(&sut.Options, &sut.State, "vtgate", started, finished))
+	layers, err = attachedLayers(tag)
+	require.NoError(t, err)
+	require.Len(t, layers, 1)
+	statement, err = verifyEnvelope(pub, layers[0].Content)
+	require.NoError(t, err)
+	require.Equal(t, "abc123", statement.Predicate.Invocation.ConfigSource.Digest["sha1"])
+
+	// Envelopes do not verify with other keys
+	_, otherPub := newTestKeyPair(t)
+	other, err := LoadPublicKey(otherPub)
+	require.NoError(t, err)
+	_, err = verifyEnvelope(other, envelope)
+	require.Error(t, err)
+
+	// Images cannot be attested without a key
+	opts.SigningKey = ""
+	require.Error(t, impl.AttestImage(&opts, &State{}, "vtgate", started, finished))
+}
@@ -0,0 +1,175 @@
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/release-utils/util"
+)
+
+const (
+	// DefaultGitHubRepository is the repository where the vitess pull
+	// requests are looked up
+	DefaultGitHubRepository = "vitessio/vitess"
+
+	githubAPIURL = "https://api.github.com"
+
+	// githubTimeout bounds each request to the GitHub API so a stalled
+	// connection does not hang the release notes
+	githubTimeout = 30 * time.Second
+)
+
+// PullRequest is the metadata of a pull request listed in the release notes
+type PullRequest struct {
+	Number int      `json:"number"`
+	Title  string   `json:"title"`
+	Author string   `json:"author"`
+	Labels []string `json:"labels"`
+}
+
+// PullRequestSource looks up the metadata of the pull requests merged
+// in a release
+type PullRequestSource interface {
+	PullRequest(number int) (*PullRequest, error)
+}
+
+// githubPullRequestSource reads the pull requests from the GitHub API
+type githubPullRequestSource struct {
+	// Repository is the owner/name of the repository
+	Repository string
+
+	// Token authenticates the requests to raise the API rate limit
+	Token string
+
+	apiURL string
+	client *http.Client
+}
+
+func newGitHubPullRequestSource(repository string) *githubPullRequestSource {
+	return &githubPullRequestSource{
+		Repository: repository,
+		Token:      os.Getenv("GITHUB_TOKEN"),
+		apiURL:     githubAPIURL,
+		client:     &http.Client{Timeout: githubTimeout},
+	}
+}
+
+// PullRequest fetches pull request number from GitHub
+func (g *githubPullRequestSource) PullRequest(number int) (*PullRequest, error) {
+	req, err := http.NewRequest(
+		http.MethodGet, fmt.Sprintf("%s/repos/%s/pulls/%d", g.apiURL, g.Repository, number), nil,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating request")
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "token "+g.Token)
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching pull request #%d", number)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("fetching pull request #%d: %s", number, resp.Status)
+	}
+
+	data := struct {
+		Number int    `json:"number"`
+		Title  string `json:"title"`
+		User   struct {
+			Login string `json:"login"`
+		} `json:"user"`
+		Labels []struct {
+			Name string `json:"name"`
+		} `json:"labels"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, errors.Wrapf(err, "decoding pull request #%d", number)
+	}
+	pr := &PullRequest{Number: data.Number, Title: data.Title, Author: data.User.Login}
+	for _, label := range data.Labels {
+		pr.Labels = append(pr.Labels, label.Name)
+	}
+	return pr, nil
+}
+
+// pullRequestCache keeps the pull requests in a JSON file. Pull requests
+// not in the cache are looked up in the upstream source and added to it,
+// without an upstream source the cache works offline.
+type pullRequestCache struct {
+	path         string
+	upstream     PullRequestSource
+	pullRequests map[int]*PullRequest
+	modified     bool
+}
+
+// loadPullRequestCache reads the cache from path. The cache starts
+// empty if path is empty or does not exist yet.
+func loadPullRequestCache(path string, upstream PullRequestSource) (*pullRequestCache, error) {
+	c := &pullRequestCache{
+		path:         path,
+		upstream:     upstream,
+		pullRequests: map[int]*PullRequest{},
+	}
+	if path == "" || !util.Exists(path) {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading pull request cache")
+	}
+	prs := []*PullRequest{}
+	if err := json.Unmarshal(data, &prs); err != nil {
+		return nil, errors.Wrapf(err, "parsing pull request cache %s", path)
+	}
+	for _, pr := range prs {
+		c.pullRequests[pr.Number] = pr
+	}
+	return c, nil
+}
+
+// PullRequest returns the cached pull request, fetching it from the
+// upstream source if needed
+func (c *pullRequestCache) PullRequest(number int) (*PullRequest, error) {
+	if pr, ok := c.pullRequests[number]; ok {
+		return pr, nil
+	}
+	if c.upstream == nil {
+		return nil, errors.New("not found in the pull request cache")
+	}
+	pr, err := c.upstream.PullRequest(number)
+	if err != nil {
+		return nil, err
+	}
+	c.pullRequests[number] = pr
+	c.modified = true
+	return pr, nil
+}
+
+// Save writes the cache back to its file if pull requests were added
+func (c *pullRequestCache) Save() error {
+	if c.path == "" || !c.modified {
+		return nil
+	}
+	prs := []*PullRequest{}
+	for _, pr := range c.pullRequests {
+		prs = append(prs, pr)
+	}
+	sort.Slice(prs, func(i, j int) bool { return prs[i].Number < prs[j].Number })
+	data, err := json.MarshalIndent(prs, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling pull request cache")
+	}
+	if err := os.WriteFile(c.path, data, os.FileMode(0o644)); err != nil {
+		return errors.Wrap(err, "writing pull request cache")
+	}
+	c.modified = false
+	return nil
+}
@@ -1 +1,159 @@
 package release
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/release-sdk/git"
+)
+
+// Names of the steps recorded in the state by the release phase
+const (
+	stepPushBranch    = "push-branch"
+	stepPushTagPrefix = "push-tag:"
+)
+
+const remoteBranchPrefix = "refs/heads/"
+
+type ReleaseImplementation interface {
+	LoadState(*ReleaseOptions, *State) error
+	SaveState(*ReleaseOptions, *State) error
+	OpenRepository(*ReleaseOptions, *State) error
+	GetRemoteBranchSHA(*ReleaseOptions, *State) (string, error)
+	PushBranch(*ReleaseOptions, *State) error
+	PushTag(*ReleaseOptions, *State, string) error
+}
+
+type ReleaseOptions struct {
+	// RepoPath is where the vitess repository is located
+	RepoPath string
+
+	// Branch is the release branch that was staged. Eg release-12.0
+	Branch string
+
+	// Remote is the name or URL of the git remote to push to
+	Remote string
+
+	// StateFile is the path to the state file written by the stage
+	StateFile string
+
+	// NoMock pushes the release branch and tags to the remote. A mock
+	// release checks the remote and logs the pushes.
+	NoMock bool
+}
+
+var DefaultReleaseOptions = ReleaseOptions{
+	Remote: git.DefaultRemote,
+}
+
+// StatePath returns the path to the file where the state is persisted
+func (o *ReleaseOptions) StatePath() string {
+	return statePath(o.StateFile, o.Branch)
+}
+
+func (o *ReleaseOptions) Validate() error {
+	if o.RepoPath == "" {
+		return errors.New("Path to repository not defined")
+	}
+	if o.Remote == "" {
+		return errors.New("remote to push the release not defined")
+	}
+	return nil
+}
+
+// Release pushes the branch and tags created by the stage to the remote
+type Release struct {
+	Options ReleaseOptions
+	impl    ReleaseImplementation
+	State   State
+}
+
+func NewRelease(o ReleaseOptions) *Release {
+	var impl ReleaseImplementation = &mockReleaseImplementation{}
+	if o.NoMock {
+		impl = &defaultReleaseImplementation{}
+	}
+	return &Release{
+		impl:    impl,
+		Options: o,
+	}
+}
+
+// Run executes the release phase
+func (r *Release) Run() error {
+	if err := r.Options.Validate(); err != nil {
+		return errors.Wrap(err, "checking release options")
+	}
+
+	if err := r.impl.LoadState(&r.Options, &r.State); err != nil {
+		return errors.Wrap(err, "loading stage state")
+	}
+
+	if r.Options.NoMock && !r.State.NoMock {
+		return errors.New("refusing to push a release that was staged in mock mode")
+	}
+
+	if !r.State.StepDone(stepTagRepository) {
+		return errors.Errorf("staging of %s did not finish", r.State.Version)
+	}
+
+	if err := r.impl.OpenRepository(&r.Options, &r.State); err != nil {
+		return errors.Wrap(err, "opening repository")
+	}
+
+	if err := r.PushBranch(); err != nil {
+		return errors.Wrap(err, "pushing release branch")
+	}
+
+	return errors.Wrap(r.PushTags(), "pushing release tags")
+}
+
+// PushBranch pushes the release branch after checking that the remote
+// has not moved since the release was staged
+func (r *Release) PushBranch() error {
+	if r.State.StepDone(stepPushBranch) {
+		logrus.Infof("Branch %s was already pushed", r.State.Branch)
+		return nil
+	}
+
+	remoteSHA, err := r.impl.GetRemoteBranchSHA(&r.Options, &r.State)
+	if err != nil {
+		return errors.Wrap(err, "getting the remote branch commit")
+	}
+
+	if remoteSHA != r.State.CurrentCommit {
+		return errors.Errorf(
+			"remote branch %s is at %s but the release was staged on top of %s",
+			r.State.Branch, remoteSHA, r.State.CurrentCommit,
+		)
+	}
+	logrus.Infof("Remote branch %s is still at %s", r.State.Branch, remoteSHA)
+
+	if err := r.impl.PushBranch(&r.Options, &r.State); err != nil {
+		return err
+	}
+	r.State.CompleteStep(stepPushBranch)
+	return r.impl.SaveState(&r.Options, &r.State)
+}
+
+// PushTags pushes the version tag and the GoDoc tag if there is one
+func (r *Release) PushTags() error {
+	tags := []string{r.State.Version}
+	if r.State.GoDocVersion != "" {
+		tags = append(tags, r.State.GoDocVersion)
+	}
+
+	for _, tag := range tags {
+		if r.State.StepDone(stepPushTagPrefix + tag) {
+			logrus.Infof("Tag %s was already pushed", tag)
+			continue
+		}
+		if err := r.impl.PushTag(&r.Options, &r.State, tag); err != nil {
+			return errors.Wrapf(err, "pushing tag %s", tag)
+		}
+		r.State.CompleteStep(stepPushTagPrefix + tag)
+		if err := r.impl.SaveState(&r.Options, &r.State); err != nil {
+			return err
+		}
+	}
+	return nil
+}
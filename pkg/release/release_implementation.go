@@ -1 +1,78 @@
 package release
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/release-sdk/git"
+	"sigs.k8s.io/release-utils/command"
+)
+
+type defaultReleaseImplementation struct{}
+
+// LoadState reads the state recorded by the stage
+func (di *defaultReleaseImplementation) LoadState(o *ReleaseOptions, s *State) error {
+	if err := loadState(o.StatePath(), s); err != nil {
+		return err
+	}
+	if o.Branch == "" {
+		o.Branch = s.Branch
+	}
+	if o.Branch != s.Branch {
+		return errors.Errorf("state was recorded for branch %s, not %s", s.Branch, o.Branch)
+	}
+	return nil
+}
+
+// SaveState records the pushes in the state file
+func (di *defaultReleaseImplementation) SaveState(o *ReleaseOptions, s *State) error {
+	return saveState(o.StatePath(), s)
+}
+
+func (di *defaultReleaseImplementation) OpenRepository(o *ReleaseOptions, s *State) error {
+	repo, err := git.OpenRepo(o.RepoPath)
+	if err != nil {
+		return errors.Wrap(err, "opening repository")
+	}
+	logrus.Infof("Opened git repository in %s", o.RepoPath)
+	s.Repository = repo
+	return nil
+}
+
+// GetRemoteBranchSHA returns the commit the release branch points to in
+// the remote
+func (di *defaultReleaseImplementation) GetRemoteBranchSHA(o *ReleaseOptions, s *State) (string, error) {
+	output, err := s.Repository.LsRemote(o.Remote, remoteBranchPrefix+s.Branch)
+	if err != nil {
+		return "", errors.Wrapf(err, "listing branch %s in remote %s", s.Branch, o.Remote)
+	}
+	fields := strings.Fields(output)
+	if len(fields) < 2 {
+		return "", errors.Errorf("branch %s not found in remote %s", s.Branch, o.Remote)
+	}
+	return fields[0], nil
+}
+
+// PushBranch pushes the release branch to the remote
+func (di *defaultReleaseImplementation) PushBranch(o *ReleaseOptions, s *State) error {
+	logrus.Infof("🚀 Pushing branch %s to %s", s.Branch, o.Remote)
+	ref := remoteBranchPrefix + s.Branch
+	return errors.Wrapf(
+		command.NewWithWorkDir(
+			o.RepoPath, "git", "push", o.Remote, ref+":"+ref,
+		).RunSilentSuccess(),
+		"pushing %s to %s", s.Branch, o.Remote,
+	)
+}
+
+// PushTag pushes a tag to the remote
+func (di *defaultReleaseImplementation) PushTag(o *ReleaseOptions, s *State, tag string) error {
+	logrus.Infof("🏷️  Pushing tag %s to %s", tag, o.Remote)
+	return errors.Wrapf(
+		command.NewWithWorkDir(
+			o.RepoPath, "git", "push", o.Remote, "refs/tags/"+tag,
+		).RunSilentSuccess(),
+		"pushing tag %s to %s", tag, o.Remote,
+	)
+}
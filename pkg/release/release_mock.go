@@ -0,0 +1,24 @@
+package release
+
+// mockReleaseImplementation checks the remote but only logs the pushes
+type mockReleaseImplementation struct {
+	defaultReleaseImplementation
+	mockRecorder
+}
+
+// SaveState does not record the mock pushes in the state file
+func (mi *mockReleaseImplementation) SaveState(o *ReleaseOptions, s *State) error {
+	return nil
+}
+
+// PushBranch logs the branch that would be pushed
+func (mi *mockReleaseImplementation) PushBranch(o *ReleaseOptions, s *State) error {
+	mi.record("push branch %s to %s", s.Branch, o.Remote)
+	return nil
+}
+
+// PushTag logs the tag that would be pushed
+func (mi *mockReleaseImplementation) PushTag(o *ReleaseOptions, s *State, tag string) error {
+	mi.record("push tag %s to %s", tag, o.Remote)
+	return nil
+}
@@ -0,0 +1,374 @@
+package release
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/release-utils/command"
+	"sigs.k8s.io/release-utils/util"
+)
+
+// Sections of the changelog in the order they are rendered
+const (
+	notesSectionBugs        = "Bug fixes"
+	notesSectionEnhancement = "Enhancements"
+	notesSectionPerformance = "Performance"
+	notesSectionDocs        = "Documentation"
+	notesSectionTesting     = "Testing"
+	notesSectionCI          = "CI/Build"
+	notesSectionCleanup     = "Internal Cleanup"
+	notesSectionRelease     = "Release"
+	notesSectionOther       = "Other"
+)
+
+var notesSections = []string{
+	notesSectionBugs, notesSectionEnhancement, notesSectionPerformance,
+	notesSectionDocs, notesSectionTesting, notesSectionCI,
+	notesSectionCleanup, notesSectionRelease, notesSectionOther,
+}
+
+// notesTypeLabels maps the vitess type labels to the changelog section
+// where the pull requests are listed
+var notesTypeLabels = map[string]string{
+	"Type: Bug":              notesSectionBugs,
+	"Type: Regression":       notesSectionBugs,
+	"Type: Enhancement":      notesSectionEnhancement,
+	"Type: Feature Request":  notesSectionEnhancement,
+	"Type: Feature":          notesSectionEnhancement,
+	"Type: Performance":      notesSectionPerformance,
+	"Type: Documentation":    notesSectionDocs,
+	"Type: Testing":          notesSectionTesting,
+	"Type: CI/Build":         notesSectionCI,
+	"Type: Internal Cleanup": notesSectionCleanup,
+	"Type: Release":          notesSectionRelease,
+}
+
+const componentLabelPrefix = "Component: "
+
+var (
+	// mergeSubjectRe matches the subject of merge commits created by GitHub
+	mergeSubjectRe = regexp.MustCompile(`^Merge pull request #(\d+) `)
+
+	// squashSubjectRe matches the subject of squashed pull requests
+	squashSubjectRe = regexp.MustCompile(`\(#(\d+)\)$`)
+)
+
+// pullRequestNumber returns the number of the pull request merged by
+// a commit with subject or 0 if it does not merge one
+func pullRequestNumber(subject string) int {
+	subject = strings.TrimSpace(subject)
+	for _, re := range []*regexp.Regexp{mergeSubjectRe, squashSubjectRe} {
+		if m := re.FindStringSubmatch(subject); m != nil {
+			n, err := strconv.Atoi(m[1])
+			if err == nil {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+// releaseNotes is the changelog of a release
+type releaseNotes struct {
+	Version string
+
+	// Summary is markdown placed before the changelog
+	Summary string
+
+	// Commits is the number of commits in the release, excluding merges
+	Commits int
+
+	// PullRequests merged in the release
+	PullRequests []*PullRequest
+}
+
+// collectReleaseNotes walks the commits in the range from..to of the
+// repository and looks up the pull requests merged in it
+func collectReleaseNotes(repoPath, version, from, to string, source PullRequestSource) (*releaseNotes, error) {
+	revRange := fmt.Sprintf("%s..%s", from, to)
+	log, err := command.NewWithWorkDir(
+		repoPath, "git", "log", "--first-parent", "--format=%s", revRange,
+	).RunSilentSuccessOutput()
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing commits in %s", revRange)
+	}
+	count, err := command.NewWithWorkDir(
+		repoPath, "git", "rev-list", "--no-merges", "--count", revRange,
+	).RunSilentSuccessOutput()
+	if err != nil {
+		return nil, errors.Wrapf(err, "counting commits in %s", revRange)
+	}
+
+	notes := &releaseNotes{Version: version}
+	notes.Commits, err = strconv.Atoi(count.OutputTrimNL())
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing commit count")
+	}
+
+	seen := map[int]bool{}
+	missing := []string{}
+	for _, subject := range strings.Split(log.OutputTrimNL(), "\n") {
+		number := pullRequestNumber(subject)
+		if number == 0 || seen[number] {
+			continue
+		}
+		seen[number] = true
+		pr, err := source.PullRequest(number)
+		if err != nil {
+			missing = append(missing, fmt.Sprintf("#%d: %v", number, err))
+			continue
+		}
+		notes.PullRequests = append(notes.PullRequests, pr)
+	}
+	if err := validationError("unable to look up pull requests", missing); err != nil {
+		return nil, err
+	}
+	sort.Slice(notes.PullRequests, func(i, j int) bool {
+		return notes.PullRequests[i].Number < notes.PullRequests[j].Number
+	})
+	return notes, nil
+}
+
+// section returns the changelog section where pr is listed
+func (pr *PullRequest) section() string {
+	for _, label := range pr.Labels {
+		if section, ok := notesTypeLabels[label]; ok {
+			return section
+		}
+	}
+	return notesSectionOther
+}
+
+// component returns the vitess component pr changes
+func (pr *PullRequest) component() string {
+	components := []string{}
+	for _, label := range pr.Labels {
+		if strings.HasPrefix(label, componentLabelPrefix) {
+			components = append(components, strings.TrimPrefix(label, componentLabelPrefix))
+		}
+	}
+	if len(components) == 0 {
+		return notesSectionOther
+	}
+	sort.Strings(components)
+	return components[0]
+}
+
+// Markdown renders the release notes
+func (n *releaseNotes) Markdown() string {
+	// Group the pull requests by section and component
+	groups := map[string]map[string][]*PullRequest{}
+	for _, pr := range n.PullRequests {
+		section, component := pr.section(), pr.component()
+		if groups[section] == nil {
+			groups[section] = map[string][]*PullRequest{}
+		}
+		groups[section][component] = append(groups[section][component], pr)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Release of Vitess %s\n\n", n.Version)
+	if summary := strings.TrimSpace(n.Summary); summary != "" {
+		b.WriteString(summary + "\n\n")
+	}
+	b.WriteString("## Changelog\n\n")
+	for _, section := range notesSections {
+		if len(groups[section]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "### %s\n\n", section)
+		for _, component := range sortedComponents(groups[section]) {
+			fmt.Fprintf(&b, "#### %s\n\n", component)
+			for _, pr := range groups[section][component] {
+				fmt.Fprintf(&b, " * %s #%d\n", pr.Title, pr.Number)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	fmt.Fprintf(&b, "The release includes %d commits (excluding merges)\n", n.Commits)
+	if contributors := n.contributors(); len(contributors) > 0 {
+		fmt.Fprintf(&b, "\nThanks to all our contributors: %s\n", strings.Join(contributors, ", "))
+	}
+	return b.String()
+}
+
+// sortedComponents returns the components in alphabetical order with
+// the pull requests not labeled with a component at the end
+func sortedComponents(components map[string][]*PullRequest) []string {
+	names := []string{}
+	for name := range components {
+		if name != notesSectionOther {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := components[notesSectionOther]; ok {
+		names = append(names, notesSectionOther)
+	}
+	return names
+}
+
+// contributors returns the handles of the pull request authors
+func (n *releaseNotes) contributors() []string {
+	seen := map[string]bool{}
+	authors := []string{}
+	for _, pr := range n.PullRequests {
+		if pr.Author == "" || seen[pr.Author] {
+			continue
+		}
+		seen[pr.Author] = true
+		authors = append(authors, "@"+pr.Author)
+	}
+	sort.Slice(authors, func(i, j int) bool {
+		return strings.ToLower(authors[i]) < strings.ToLower(authors[j])
+	})
+	return authors
+}
+
+var (
+	// notesHeadingRe matches markdown headings
+	notesHeadingRe = regexp.MustCompile(`^#{1,6}\s+(.*)$`)
+
+	// notesListItemRe matches the items of markdown lists
+	notesListItemRe = regexp.MustCompile(`^\s*[*+-]\s+\S`)
+
+	// notesPlaceholderRe matches text left to be filled in
+	notesPlaceholderRe = regexp.MustCompile(`\b(TODO|TBD|FIXME|XXX)\b|(?i)lorem ipsum|<placeholder>|\{\{|\}\}`)
+
+	// notesLinkRe matches inline links and images, notesRefLinkRe
+	// reference links and notesLinkDefRe the link definitions
+	notesLinkRe    = regexp.MustCompile(`\[([^\[\]]*)\]\(([^()]*)\)`)
+	notesRefLinkRe = regexp.MustCompile(`\[([^\[\]]+)\]\[([^\[\]]*)\]`)
+	notesLinkDefRe = regexp.MustCompile(`^\s{0,3}\[([^\[\]]+)\]:\s*(\S*)`)
+)
+
+// validateReleaseNotes checks the release notes of version in path and
+// returns a list of the problems found
+func validateReleaseNotes(path, version string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []string{fmt.Sprintf("unable to read release notes: %v", err)}
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return []string{fmt.Sprintf("release notes file %s is empty", path)}
+	}
+
+	problems := []string{}
+	versionHeading, inChangelog, changelogFound := false, false, false
+	changes := 0
+	definitions := map[string]string{}
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines {
+		if m := notesLinkDefRe.FindStringSubmatch(line); m != nil {
+			definitions[strings.ToLower(m[1])] = m[2]
+		}
+	}
+
+	for i, line := range lines {
+		where := fmt.Sprintf("line %d", i+1)
+		if m := notesHeadingRe.FindStringSubmatch(line); m != nil {
+			if headingHasVersion(m[1], version) {
+				versionHeading = true
+			}
+			inChangelog = strings.Contains(strings.ToLower(m[1]), "changelog") ||
+				(inChangelog && strings.HasPrefix(line, "###"))
+			changelogFound = changelogFound || inChangelog
+			continue
+		}
+
+		// Changelog entries are pull request titles, only the text
+		// written by the release team is checked for placeholders
+		if inChangelog && notesListItemRe.MatchString(line) {
+			changes++
+		} else if m := notesPlaceholderRe.FindString(line); m != "" {
+			problems = append(problems, fmt.Sprintf("%s: placeholder text %q", where, m))
+		}
+
+		for _, m := range notesLinkRe.FindAllStringSubmatch(line, -1) {
+			if problem := checkNotesLink(path, m[1], m[2]); problem != "" {
+				problems = append(problems, fmt.Sprintf("%s: %s", where, problem))
+			}
+		}
+		for _, m := range notesRefLinkRe.FindAllStringSubmatch(line, -1) {
+			ref := m[2]
+			if ref == "" {
+				ref = m[1]
+			}
+			target, ok := definitions[strings.ToLower(ref)]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s: link reference %q is not defined", where, ref))
+			} else if problem := checkNotesLink(path, m[1], target); problem != "" {
+				problems = append(problems, fmt.Sprintf("%s: %s", where, problem))
+			}
+		}
+	}
+
+	if !versionHeading {
+		problems = append(problems, fmt.Sprintf("no heading for version %s", version))
+	}
+	if !changelogFound {
+		problems = append(problems, "no changelog section")
+	} else if changes == 0 {
+		problems = append(problems, "the changelog does not list any changes")
+	}
+	return problems
+}
+
+// headingHasVersion returns true if the heading text names version,
+// with or without the v prefix
+func headingHasVersion(heading, version string) bool {
+	for _, field := range strings.Fields(heading) {
+		field = strings.Trim(field, "`*_:,()")
+		if field == version || "v"+field == version {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNotesLink returns the problem with a link in the release notes
+// at path or an empty string if the link is valid
+func checkNotesLink(path, text, target string) string {
+	target = strings.TrimSpace(target)
+	// Drop the link title
+	if i := strings.IndexAny(target, " \t"); i != -1 {
+		target = target[:i]
+	}
+	target = strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+	switch {
+	case target == "":
+		return fmt.Sprintf("link %q has no target", text)
+	case strings.HasPrefix(target, "#"):
+		return ""
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Sprintf("link %q has an invalid target %q: %v", text, target, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return fmt.Sprintf("link %q has no host in %q", text, target)
+		}
+		return ""
+	case "mailto":
+		return ""
+	case "":
+		// Relative links point to files in the repository
+		if !util.Exists(filepath.Join(filepath.Dir(path), filepath.FromSlash(u.Path))) {
+			return fmt.Sprintf("link %q points to missing file %s", text, u.Path)
+		}
+		return ""
+	default:
+		return fmt.Sprintf("link %q has unsupported scheme %q", text, u.Scheme)
+	}
+}
@@ -0,0 +1,256 @@
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPullRequestNumber(t *testing.T) {
+	for subject, number := range map[string]int{
+		"Merge pull request #9123 from user/fix-panic":  9123,
+		"Fix vtgate panic on empty result (#9124)":      9124,
+		"[release-12.0] Backport of #9000 (#9125)":      9125,
+		"Release commit for v12.0.3":                    0,
+		"Mention #9126 somewhere in the middle (later)": 0,
+	} {
+		require.Equal(t, number, pullRequestNumber(subject), subject)
+	}
+}
+
+func TestGenerateReleaseNotes(t *testing.T) {
+	repo := newTestRepo(t)
+	dir := repo.Dir()
+	from := strings.TrimSpace(runGit(t, dir, "rev-parse", "HEAD"))
+
+	// A merged pull request with two commits
+	runGit(t, dir, "checkout", "-b", "fix-panic")
+	runGit(t, dir, "commit", "--allow-empty", "-m", "Fix panic")
+	runGit(t, dir, "commit", "--allow-empty", "-m", "Add test")
+	runGit(t, dir, "checkout", "release-12.0")
+	runGit(t, dir, "merge", "--no-ff", "-m", "Merge pull request #101 from user/fix-panic", "fix-panic")
+
+	// Squashed pull requests and a commit without one
+	runGit(t, dir, "commit", "--allow-empty", "-m", "Add vtorc flag (#103)")
+	runGit(t, dir, "commit", "--allow-empty", "-m", "Update docs (#102)")
+	runGit(t, dir, "commit", "--allow-empty", "-m", "Commit pushed directly")
+	to := strings.TrimSpace(runGit(t, dir, "rev-parse", "HEAD"))
+
+	cache := filepath.Join(t.TempDir(), "prs.json")
+	data, err := json.Marshal([]*PullRequest{
+		{Number: 101, Title: "Fix panic", Author: "zoe", Labels: []string{"Type: Bug", "Component: VTGate"}},
+		{Number: 102, Title: "Update docs", Author: "alice", Labels: []string{"Type: Documentation"}},
+		{Number: 103, Title: "Add vtorc flag", Author: "Bob", Labels: []string{"Type: Enhancement", "Component: VTorc"}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(cache, data, os.FileMode(0o644)))
+
+	impl := &DefaultStageImplementation{}
+	o := &StageOptions{RepoPath: dir, NotesCache: cache, Offline: true}
+	s := &State{Version: "v12.0.4", PreviousVersion: "v12.0.3"}
+	s.SemVer.Major, s.SemVer.Minor, s.SemVer.Patch = 12, 0, 4
+	require.NoError(t, impl.GenerateReleaseNotes(o, s, from, to))
+	require.Equal(t, filepath.Join(dir, "doc/releasenotes/12_0_4_release_notes.md"), s.ReleaseNotesPath)
+
+	notes, err := os.ReadFile(s.ReleaseNotesPath)
+	require.NoError(t, err)
+	require.Equal(t, `# Release of Vitess v12.0.4
+
+## Summary
+
+This is a patch release of the Vitess 12.0 release series. It includes 3 pull requests merged since v12.0.3, listed in the changelog below.
+
+## Changelog
+
+### Bug fixes
+
+#### VTGate
+
+ * Fix panic #101
+
+### Enhancements
+
+#### VTorc
+
+ * Add vtorc flag #103
+
+### Documentation
+
+#### Other
+
+ * Update docs #102
+
+The release includes 5 commits (excluding merges)
+
+Thanks to all our contributors: @alice, @Bob, @zoe
+`, string(notes))
+	require.NoError(t, impl.ValidateReleaseNotes(o, s))
+
+	// A summary file replaces the standard summary
+	summary := filepath.Join(dir, "doc/releasenotes/12_0_4_summary.md")
+	require.NoError(t, os.WriteFile(summary, []byte("## Major Changes\n\nA fix.\n"), os.FileMode(0o644)))
+	require.NoError(t, impl.GenerateReleaseNotes(o, s, from, to))
+	notes, err = os.ReadFile(s.ReleaseNotesPath)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(
+		string(notes), "# Release of Vitess v12.0.4\n\n## Major Changes\n\nA fix.\n\n## Changelog\n\n",
+	), string(notes))
+
+	// GA releases require a summary
+	ga := &State{Version: "v13.0.0", PreviousVersion: "v13.0.0-rc1"}
+	ga.SemVer.Major = 13
+	err = impl.GenerateReleaseNotes(o, ga, from, to)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "13_0_0_summary.md not found")
+
+	// So does an explicit summary file
+	err = impl.GenerateReleaseNotes(&StageOptions{
+		RepoPath: dir, NotesCache: cache, Offline: true, SummaryFile: filepath.Join(dir, "missing.md"),
+	}, s, from, to)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "missing.md not found")
+
+	// Pull requests missing from the cache fail offline
+	runGit(t, dir, "commit", "--allow-empty", "-m", "Not cached (#104)")
+	to = strings.TrimSpace(runGit(t, dir, "rev-parse", "HEAD"))
+	err = impl.GenerateReleaseNotes(o, s, from, to)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "#104")
+}
+
+func TestPullRequestCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "token secret", r.Header.Get("Authorization"))
+		if r.URL.Path != "/repos/vitessio/vitess/pulls/101" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{
+			"number": 101, "title": "Fix panic", "user": {"login": "zoe"},
+			"labels": [{"name": "Type: Bug"}, {"name": "Component: VTGate"}]
+		}`))
+	}))
+	defer server.Close()
+
+	github := newGitHubPullRequestSource("vitessio/vitess")
+	github.Token = "secret"
+	github.apiURL = server.URL
+
+	path := filepath.Join(t.TempDir(), "prs.json")
+	cache, err := loadPullRequestCache(path, github)
+	require.NoError(t, err)
+
+	pr, err := cache.PullRequest(101)
+	require.NoError(t, err)
+	expected := &PullRequest{
+		Number: 101, Title: "Fix panic", Author: "zoe", Labels: []string{"Type: Bug", "Component: VTGate"},
+	}
+	require.Equal(t, expected, pr)
+	_, err = cache.PullRequest(102)
+	require.Error(t, err)
+	require.NoError(t, cache.Save())
+
+	// Reloaded offline, the cache has the fetched pull request
+	cache, err = loadPullRequestCache(path, nil)
+	require.NoError(t, err)
+	pr, err = cache.PullRequest(101)
+	require.NoError(t, err)
+	require.Equal(t, expected, pr)
+	_, err = cache.PullRequest(102)
+	require.Error(t, err)
+}
+
+func TestValidateReleaseNotes(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "12_0_4_summary.md"), []byte("summary"), os.FileMode(0o644)))
+	const valid = `# Release of Vitess v12.0.4
+
+## Summary
+
+See the [full summary](12_0_4_summary.md), the [docs][docs] and [upgrading](#upgrading).
+
+## Changelog
+
+### Bug fixes
+
+#### VTGate
+
+ * Remove TODO comments from the planner #101
+
+The release includes 5 commits (excluding merges)
+
+[docs]: https://vitess.io/docs/
+`
+
+	for _, tc := range []struct {
+		name     string
+		notes    string
+		problems []string
+	}{
+		{name: "valid", notes: valid},
+		{
+			name:     "empty",
+			notes:    "\n  \n",
+			problems: []string{"release notes file %s is empty"},
+		},
+		{
+			name:     "wrong version",
+			notes:    strings.Replace(valid, "v12.0.4", "v12.0.3", 1),
+			problems: []string{"no heading for version v12.0.4"},
+		},
+		{
+			name:     "no changes",
+			notes:    strings.Replace(valid, " * Remove TODO comments from the planner #101\n", "", 1),
+			problems: []string{"the changelog does not list any changes"},
+		},
+		{
+			name:     "no changelog",
+			notes:    "# Release of Vitess 12.0.4\n\nNothing to see.\n",
+			problems: []string{"no changelog section"},
+		},
+		{
+			name:  "placeholders",
+			notes: strings.Replace(valid, "## Summary\n", "## Summary\n\nTODO: write the summary {{ .Summary }}\n", 1),
+			problems: []string{
+				`line 5: placeholder text "TODO"`,
+			},
+		},
+		{
+			name: "broken links",
+			notes: strings.Replace(
+				valid, "[upgrading](#upgrading)",
+				"[missing](11_0_0_summary.md), [empty]() [host](https:///path) [ref][nope] [ftp](ftp://vitess.io)", 1,
+			),
+			problems: []string{
+				`line 5: link "missing" points to missing file 11_0_0_summary.md`,
+				`line 5: link "empty" has no target`,
+				`line 5: link "host" has no host in "https:///path"`,
+				`line 5: link "ftp" has unsupported scheme "ftp"`,
+				`line 5: link reference "nope" is not defined`,
+			},
+		},
+	} {
+		path := filepath.Join(dir, "12_0_4_release_notes.md")
+		require.NoError(t, os.WriteFile(path, []byte(tc.notes), os.FileMode(0o644)))
+		expected := []string{}
+		for _, p := range tc.problems {
+			if strings.Contains(p, "%s") {
+				p = fmt.Sprintf(p, path)
+			}
+			expected = append(expected, p)
+		}
+		require.Equal(t, expected, validateReleaseNotes(path, "v12.0.4"), tc.name)
+	}
+
+	require.Equal(t,
+		[]string{"unable to read release notes: open missing.md: no such file or directory"},
+		validateReleaseNotes("missing.md", "v12.0.4"),
+	)
+}
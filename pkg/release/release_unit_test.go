@@ -0,0 +1,90 @@
+package release
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newStagedRepo returns a repository with a staged release on top of
+// a commit that was pushed to a bare remote. It returns the options
+// to release it and the path to the remote.
+func newStagedRepo(t *testing.T) (opts ReleaseOptions, remote string) {
+	repo := newTestRepo(t)
+	remote = filepath.Join(t.TempDir(), "remote.git")
+	runGit(t, repo.Dir(), "clone", "--bare", repo.Dir(), remote)
+	runGit(t, repo.Dir(), "remote", "add", "origin", remote)
+	currentCommit := strings.TrimSpace(runGit(t, repo.Dir(), "rev-parse", "HEAD"))
+
+	runGit(t, repo.Dir(), "commit", "--allow-empty", "-m", "Release commit for v12.0.4")
+	runGit(t, repo.Dir(), "tag", "-a", "-m", "Release commit for v12.0.4", "v12.0.4")
+	runGit(t, repo.Dir(), "tag", "-a", "-m", "GoDoc", "v0.12.4")
+	runGit(t, repo.Dir(), "commit", "--allow-empty", "-m", "Back to dev mode")
+
+	state := &State{
+		Branch:        "release-12.0",
+		Version:       "v12.0.4",
+		GoDocVersion:  "v0.12.4",
+		CurrentCommit: currentCommit,
+		NoMock:        true,
+		Steps:         []string{stepPrepareEnvironment, stepReleaseNotes, stepTagRepository},
+	}
+	opts = ReleaseOptions{
+		RepoPath:  repo.Dir(),
+		Remote:    "origin",
+		StateFile: filepath.Join(t.TempDir(), "state.json"),
+		NoMock:    true,
+	}
+	require.NoError(t, saveState(opts.StateFile, state))
+	return opts, remote
+}
+
+func TestReleasePush(t *testing.T) {
+	opts, remote := newStagedRepo(t)
+	require.NoError(t, NewRelease(opts).Run())
+
+	localHead := strings.TrimSpace(runGit(t, opts.RepoPath, "rev-parse", "HEAD"))
+	remoteHead := strings.TrimSpace(runGit(t, remote, "rev-parse", "release-12.0"))
+	require.Equal(t, localHead, remoteHead)
+
+	tags := runGit(t, remote, "tag")
+	require.Contains(t, tags, "v12.0.4")
+	require.Contains(t, tags, "v0.12.4")
+
+	state := &State{}
+	require.NoError(t, loadState(opts.StateFile, state))
+	require.True(t, state.StepDone(stepPushBranch))
+	require.True(t, state.StepDone(stepPushTagPrefix+"v12.0.4"))
+
+	// Running again should not fail as everything was pushed
+	require.NoError(t, NewRelease(opts).Run())
+}
+
+func TestReleaseRemoteMoved(t *testing.T) {
+	opts, remote := newStagedRepo(t)
+
+	// Somebody pushes to the remote branch after staging
+	other := filepath.Join(t.TempDir(), "other")
+	runGit(t, filepath.Dir(other), "clone", remote, other)
+	runGit(t, other, "config", "user.name", "Someone Else")
+	runGit(t, other, "config", "user.email", "someone@example.com")
+	require.NoError(t, os.WriteFile(filepath.Join(other, "NEW.md"), []byte("new\n"), os.FileMode(0o644)))
+	runGit(t, other, "add", "NEW.md")
+	runGit(t, other, "commit", "-m", "Sneaky commit")
+	runGit(t, other, "push", "origin", "release-12.0")
+
+	require.Error(t, NewRelease(opts).Run())
+	require.NotContains(t, runGit(t, remote, "tag"), "v12.0.4")
+}
+
+func TestReleaseMockStaged(t *testing.T) {
+	opts, _ := newStagedRepo(t)
+	state := &State{}
+	require.NoError(t, loadState(opts.StateFile, state))
+	state.NoMock = false
+	require.NoError(t, saveState(opts.StateFile, state))
+	require.Error(t, NewRelease(opts).Run())
+}
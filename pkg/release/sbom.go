@@ -0,0 +1,383 @@
+package release
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/pkg/errors"
+)
+
+const (
+	sbomTagSuffix = "sbom"
+
+	spdxMediaType      = "text/spdx+json"
+	cycloneDXMediaType = "application/vnd.cyclonedx+json"
+
+	packageTypeDeb    = "deb"
+	packageTypeGolang = "golang"
+)
+
+// Go binaries embed their module information between these sentinels,
+// see cmd/go/internal/modload/build.go
+var (
+	modinfoStart, _ = hex.DecodeString("3077af0c9274080241e1c107e6d618e6")
+	modinfoEnd, _   = hex.DecodeString("f932433186182072008242104116d8f2")
+
+	elfMagic = []byte("\x7fELF")
+)
+
+// sbom is the bill of materials of a release artifact, it is rendered
+// as SPDX or CycloneDX
+type sbom struct {
+	// Name and version of the artifact described
+	Name    string
+	Version string
+
+	Created  time.Time
+	Packages []sbomPackage
+}
+
+type sbomPackage struct {
+	Type    string
+	Name    string
+	Version string
+
+	// Qualifiers added to the package URL, eg arch or distro
+	Qualifiers map[string]string
+}
+
+// PURL returns the package URL of the package
+func (p *sbomPackage) PURL() string {
+	namespace := ""
+	if p.Type == packageTypeDeb {
+		namespace = "debian/"
+	}
+	purl := fmt.Sprintf(
+		"pkg:%s/%s%s@%s", p.Type, namespace, p.Name,
+		strings.ReplaceAll(url.PathEscape(p.Version), ":", "%3A"),
+	)
+	if len(p.Qualifiers) == 0 {
+		return purl
+	}
+	q := []string{}
+	for _, k := range sortedKeys(p.Qualifiers) {
+		q = append(q, fmt.Sprintf("%s=%s", k, url.QueryEscape(p.Qualifiers[k])))
+	}
+	return purl + "?" + strings.Join(q, "&")
+}
+
+// addPackages adds packages to the sbom skipping duplicates and keeps
+// the list sorted
+func (s *sbom) addPackages(pkgs ...sbomPackage) {
+	seen := map[string]bool{}
+	for i := range s.Packages {
+		seen[s.Packages[i].PURL()] = true
+	}
+	for i := range pkgs {
+		if purl := pkgs[i].PURL(); !seen[purl] {
+			seen[purl] = true
+			s.Packages = append(s.Packages, pkgs[i])
+		}
+	}
+	sort.Slice(s.Packages, func(i, j int) bool {
+		return s.Packages[i].PURL() < s.Packages[j].PURL()
+	})
+}
+
+// imageSBOM inventories the debian packages and the go modules compiled
+// into the binaries of a single platform image
+func imageSBOM(img v1.Image, name, version, distro string) (*sbom, error) {
+	doc := &sbom{Name: name, Version: version, Created: time.Now().UTC()}
+
+	fs := mutate.Extract(img)
+	defer fs.Close()
+	tr := tar.NewReader(fs)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "reading image filesystem")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		filePath := path.Clean("/" + hdr.Name)
+		switch {
+		case filePath == "/var/lib/dpkg/status" || path.Dir(filePath) == "/var/lib/dpkg/status.d":
+			pkgs, err := dpkgPackages(tr, distro)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parsing %s", filePath)
+			}
+			doc.addPackages(pkgs...)
+		case hdr.Mode&0o111 != 0:
+			// Only ELF files are loaded to look for go module information
+			br := bufio.NewReader(tr)
+			if magic, err := br.Peek(4); err != nil || !bytes.Equal(magic, elfMagic) {
+				continue
+			}
+			binary, err := io.ReadAll(br)
+			if err != nil {
+				return nil, errors.Wrapf(err, "reading %s", filePath)
+			}
+			doc.addPackages(goModules(binary)...)
+		}
+	}
+	return doc, nil
+}
+
+// dpkgPackages parses the installed packages from a dpkg status file
+func dpkgPackages(r io.Reader, distro string) ([]sbomPackage, error) {
+	pkgs := []sbomPackage{}
+	fields := map[string]string{}
+	flush := func() {
+		if fields["Package"] != "" && strings.HasSuffix(fields["Status"], " installed") {
+			pkg := sbomPackage{
+				Type:       packageTypeDeb,
+				Name:       fields["Package"],
+				Version:    fields["Version"],
+				Qualifiers: map[string]string{},
+			}
+			if arch := fields["Architecture"]; arch != "" {
+				pkg.Qualifiers["arch"] = arch
+			}
+			if distro != "" {
+				pkg.Qualifiers["distro"] = "debian-" + distro
+			}
+			pkgs = append(pkgs, pkg)
+		}
+		fields = map[string]string{}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		// Continuation lines belong to multiline fields we don't need
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 {
+			fields[parts[0]] = strings.TrimSpace(parts[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return pkgs, nil
+}
+
+// goModules returns the modules recorded in a go binary. Binaries
+// without module information return no packages.
+func goModules(binary []byte) []sbomPackage {
+	if !bytes.HasPrefix(binary, elfMagic) {
+		return nil
+	}
+	start := bytes.Index(binary, modinfoStart)
+	if start == -1 {
+		return nil
+	}
+	start += len(modinfoStart)
+	end := bytes.Index(binary[start:], modinfoEnd)
+	if end == -1 {
+		return nil
+	}
+
+	pkgs := []sbomPackage{}
+	for _, line := range strings.Split(string(binary[start:start+end]), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			continue
+		}
+		switch fields[0] {
+		case "mod", "dep":
+			pkgs = append(pkgs, sbomPackage{
+				Type: packageTypeGolang, Name: fields[1], Version: fields[2],
+			})
+		case "=>":
+			// Replacements override the module in the previous line
+			if len(pkgs) > 0 {
+				pkgs[len(pkgs)-1].Name = fields[1]
+				pkgs[len(pkgs)-1].Version = fields[2]
+			}
+		}
+	}
+	return pkgs
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generating uuid")
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// SPDX renders the sbom as an SPDX 2.2 JSON document
+func (s *sbom) SPDX() ([]byte, error) {
+	id, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	newPackage := func(spdxID, name, version string) spdxPackage {
+		return spdxPackage{
+			Name:             name,
+			SPDXID:           spdxID,
+			VersionInfo:      version,
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+			CopyrightText:    "NOASSERTION",
+		}
+	}
+
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.2",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              fmt.Sprintf("%s-%s", s.Name, s.Version),
+		DocumentNamespace: fmt.Sprintf("https://vitess.io/spdx/%s-%s-%s", s.Name, s.Version, id),
+		CreationInfo: spdxCreationInfo{
+			Created:  s.Created.Format(time.RFC3339),
+			Creators: []string{"Tool: vtrelease"},
+		},
+		Packages: []spdxPackage{newPackage("SPDXRef-Package-artifact", s.Name, s.Version)},
+		Relationships: []spdxRelationship{{
+			SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-Package-artifact",
+		}},
+	}
+	for i := range s.Packages {
+		p := newPackage(fmt.Sprintf("SPDXRef-Package-%s-%d", s.Packages[i].Type, i), s.Packages[i].Name, s.Packages[i].Version)
+		p.ExternalRefs = []spdxExternalRef{{
+			ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: s.Packages[i].PURL(),
+		}}
+		doc.Packages = append(doc.Packages, p)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID: "SPDXRef-Package-artifact", RelationshipType: "CONTAINS", RelatedSPDXElement: p.SPDXID,
+		})
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	return b, errors.Wrap(err, "marshaling spdx document")
+}
+
+type cycloneDXDocument struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     cycloneDXMetadata    `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     []cycloneDXTool    `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTool struct {
+	Name string `json:"name"`
+}
+
+type cycloneDXComponent struct {
+	BOMRef  string `json:"bom-ref,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	PURL    string `json:"purl,omitempty"`
+}
+
+// CycloneDX renders the sbom as a CycloneDX 1.4 JSON document
+func (s *sbom) CycloneDX() ([]byte, error) {
+	id, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	doc := cycloneDXDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: "urn:uuid:" + id,
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: s.Created.Format(time.RFC3339),
+			Tools:     []cycloneDXTool{{Name: "vtrelease"}},
+			Component: cycloneDXComponent{Type: "application", Name: s.Name, Version: s.Version},
+		},
+		Components: []cycloneDXComponent{},
+	}
+	for i := range s.Packages {
+		purl := s.Packages[i].PURL()
+		doc.Components = append(doc.Components, cycloneDXComponent{
+			BOMRef:  purl,
+			Type:    "library",
+			Name:    s.Packages[i].Name,
+			Version: s.Packages[i].Version,
+			PURL:    purl,
+		})
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	return b, errors.Wrap(err, "marshaling cyclonedx document")
+}
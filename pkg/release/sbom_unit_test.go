@@ -0,0 +1,213 @@
+package release
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+)
+
+const testDpkgStatus = `Package: libc6
+Status: install ok installed
+Architecture: amd64
+Version: 2.28-10
+Description: GNU C Library: Shared libraries
+ Contains the standard libraries.
+
+Package: tzdata
+Status: install ok installed
+Architecture: all
+Version: 2021a-0+deb10u1
+
+Package: removed
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 1.0
+`
+
+// testGoBinary returns a fake ELF binary with go module information
+func testGoBinary() []byte {
+	modinfo := "path\tvitess.io/vitess/go/cmd/vtgate\n" +
+		"mod\tvitess.io/vitess\t(devel)\t\n" +
+		"dep\tgithub.com/pkg/errors\tv0.9.1\th1:abc=\n" +
+		"dep\tgithub.com/golang/glog\tv1.0.0\th1:abc=\n" +
+		"=>\tgithub.com/planetscale/glog\tv1.0.1\th1:def=\n"
+	return []byte("\x7fELF\x02\x01\x01" + string(modinfoStart) + modinfo + string(modinfoEnd) + "\x00\x00")
+}
+
+// pushTestSBOMImage pushes an index with one image holding a dpkg
+// database and a go binary
+func pushTestSBOMImage(t *testing.T, ref string) {
+	idx := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+		Add:        testSBOMImage(t),
+		Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}},
+	})
+	r, err := name.ParseReference(ref)
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(r, idx))
+}
+
+// testSBOMImage returns a linux/amd64 image with debian packages and a
+// go binary
+func testSBOMImage(t *testing.T) v1.Image {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, f := range []struct {
+		name    string
+		mode    int64
+		content []byte
+	}{
+		{"var/lib/dpkg/status", 0o644, []byte(testDpkgStatus)},
+		{"vt/bin/vtgate", 0o755, testGoBinary()},
+		{"vt/bin/script.sh", 0o755, []byte("#!/bin/sh\n")},
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name: f.name, Mode: f.mode, Size: int64(len(f.content)), Typeflag: tar.TypeReg,
+		}))
+		_, err := tw.Write(f.content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	require.NoError(t, err)
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	require.NoError(t, err)
+	conf, err := img.ConfigFile()
+	require.NoError(t, err)
+	conf.OS, conf.Architecture = "linux", "amd64"
+	img, err = mutate.ConfigFile(img, conf)
+	require.NoError(t, err)
+	return img
+}
+
+func TestDpkgPackages(t *testing.T) {
+	pkgs, err := dpkgPackages(strings.NewReader(testDpkgStatus), "buster")
+	require.NoError(t, err)
+	require.Len(t, pkgs, 2)
+	require.Equal(t, "pkg:deb/debian/libc6@2.28-10?arch=amd64&distro=debian-buster", pkgs[0].PURL())
+	require.Equal(t, "pkg:deb/debian/tzdata@2021a-0+deb10u1?arch=all&distro=debian-buster", pkgs[1].PURL())
+
+	epoch := sbomPackage{Type: packageTypeDeb, Name: "adduser", Version: "1:3.118"}
+	require.Equal(t, "pkg:deb/debian/adduser@1%3A3.118", epoch.PURL())
+}
+
+func TestGoModules(t *testing.T) {
+	pkgs := goModules(testGoBinary())
+	purls := []string{}
+	for i := range pkgs {
+		purls = append(purls, pkgs[i].PURL())
+	}
+	require.Equal(t, []string{
+		"pkg:golang/vitess.io/vitess@%28devel%29",
+		"pkg:golang/github.com/pkg/errors@v0.9.1",
+		"pkg:golang/github.com/planetscale/glog@v1.0.1",
+	}, purls)
+
+	require.Empty(t, goModules([]byte("#!/bin/sh\n")))
+	require.Empty(t, goModules([]byte("\x7fELF no module info")))
+}
+
+func TestGenerateSBOMs(t *testing.T) {
+	reg := newTestRegistry(t) + "/vitess"
+	pushTestSBOMImage(t, reg+"/vtgate:v12.0.4-buster")
+
+	opts := &BuildOptions{
+		VTBaseVersion:   "v12.0.4",
+		DebianVersions:  []string{"buster"},
+		StagingRegistry: reg,
+		ArtifactsDir:    t.TempDir(),
+	}
+	require.NoError(t, (&defaultBuildImplementation{}).GenerateSBOMs(opts, &State{}, "vtgate"))
+
+	spdxData, err := os.ReadFile(filepath.Join(opts.ArtifactsDir, "sbom", "vtgate-v12.0.4-buster-linux-amd64.spdx.json"))
+	require.NoError(t, err)
+	spdx := spdxDocument{}
+	require.NoError(t, json.Unmarshal(spdxData, &spdx))
+	require.Equal(t, "SPDX-2.2", spdx.SPDXVersion)
+	// The image itself, two debian packages and three go modules
+	require.Len(t, spdx.Packages, 6)
+	require.Len(t, spdx.Relationships, 6)
+
+	cdxData, err := os.ReadFile(filepath.Join(opts.ArtifactsDir, "sbom", "vtgate-v12.0.4-buster-linux-amd64.cdx.json"))
+	require.NoError(t, err)
+	cdx := cycloneDXDocument{}
+	require.NoError(t, json.Unmarshal(cdxData, &cdx))
+	require.Equal(t, "CycloneDX", cdx.BOMFormat)
+	require.Len(t, cdx.Components, 5)
+
+	// Both documents are attached to the platform image digest
+	ref, err := name.ParseReference(reg + "/vtgate:v12.0.4-buster")
+	require.NoError(t, err)
+	idx, err := remote.Index(ref)
+	require.NoError(t, err)
+	manifest, err := idx.IndexManifest()
+	require.NoError(t, err)
+	tag, err := attachedTag(ref.Context().Digest(manifest.Manifests[0].Digest.String()), sbomTagSuffix)
+	require.NoError(t, err)
+	layers, err := attachedLayers(tag)
+	require.NoError(t, err)
+	require.Len(t, layers, 2)
+	require.EqualValues(t, spdxMediaType, layers[0].MediaType)
+	require.Equal(t, spdxData, layers[0].Content)
+	require.EqualValues(t, cycloneDXMediaType, layers[1].MediaType)
+	require.Equal(t, cdxData, layers[1].Content)
+
+	// Generating the SBOMs again replaces the attached documents
+	require.NoError(t, (&defaultBuildImplementation{}).GenerateSBOMs(opts, &State{}, "vtgate"))
+	layers, err = attachedLayers(tag)
+	require.NoError(t, err)
+	require.Len(t, layers, 2)
+	require.EqualValues(t, spdxMediaType, layers[0].MediaType)
+	require.EqualValues(t, cycloneDXMediaType, layers[1].MediaType)
+}
+
+func TestGenerateSBOMsSingleImage(t *testing.T) {
+	// Single platform builds push an image instead of an index
+	reg := newTestRegistry(t) + "/vitess"
+	ref, err := name.ParseReference(reg + "/vtgate:v12.0.4-bullseye")
+	require.NoError(t, err)
+	img := testSBOMImage(t)
+	require.NoError(t, remote.Write(ref, img))
+
+	opts := &BuildOptions{
+		VTBaseVersion:   "v12.0.4",
+		DebianVersions:  []string{"bullseye"},
+		StagingRegistry: reg,
+		ArtifactsDir:    t.TempDir(),
+	}
+	require.NoError(t, (&defaultBuildImplementation{}).GenerateSBOMs(opts, &State{}, "vtgate"))
+
+	spdxData, err := os.ReadFile(filepath.Join(opts.ArtifactsDir, "sbom", "vtgate-v12.0.4-bullseye-linux-amd64.spdx.json"))
+	require.NoError(t, err)
+	spdx := spdxDocument{}
+	require.NoError(t, json.Unmarshal(spdxData, &spdx))
+	require.Len(t, spdx.Packages, 6)
+
+	// The documents are attached to the image digest
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	tag, err := attachedTag(ref.Context().Digest(digest.String()), sbomTagSuffix)
+	require.NoError(t, err)
+	layers, err := attachedLayers(tag)
+	require.NoError(t, err)
+	require.Len(t, layers, 2)
+	require.Equal(t, spdxData, layers[0].Content)
+}
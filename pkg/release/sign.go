@@ -0,0 +1,189 @@
+package release
+
+import (
+	"crypto"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type SignImplementation interface {
+	DiscoverImages(*SignOptions) ([]string, error)
+	ListTags(*SignOptions, string) ([]string, error)
+	ResolveDigest(*SignOptions, string) (string, error)
+	SignImage(*SignOptions, crypto.Signer, string) error
+	VerifyImage(*SignOptions, crypto.PublicKey, string) error
+}
+
+type SignOptions struct {
+	// Path to vitess repository, used to discover the images
+	RepoPath string
+
+	// Version whose images will be signed, eg v12.0.4
+	Version string
+
+	// Registry where the images live
+	Registry string
+
+	// Images to sign. If empty, all images in the repo are signed
+	Images []string
+
+	// PEM encoded ECDSA private key used to sign
+	KeyPath string
+
+	// PEM encoded public key used to verify the signatures
+	PublicKeyPath string
+
+	// NoMock pushes the image signatures to the registry. Without it
+	// the images are read and the signatures are logged, not written.
+	NoMock bool
+}
+
+var DefaultSignOptions = SignOptions{
+	Registry: DefaultBuildOptions.StagingRegistry,
+}
+
+func (o *SignOptions) validate() []string {
+	problems := []string{}
+	if o.Version == "" {
+		problems = append(problems, "version not defined")
+	}
+	if _, err := name.NewRepository(o.Registry, name.StrictValidation); err != nil {
+		problems = append(problems, fmt.Sprintf("invalid registry %q: %v", o.Registry, err))
+	}
+	return problems
+}
+
+// Sign signs the images of a release with a key pair and verifies the
+// signatures stored in the registry
+type Sign struct {
+	Options SignOptions
+	impl    SignImplementation
+}
+
+func NewSign(o SignOptions) *Sign {
+	var impl SignImplementation = &mockSignImplementation{}
+	if o.NoMock {
+		impl = &defaultSignImplementation{}
+	}
+	return &Sign{
+		impl:    impl,
+		Options: o,
+	}
+}
+
+// Run signs the digest of every tag of the release images
+func (s *Sign) Run() error {
+	problems := s.Options.validate()
+	if s.Options.KeyPath == "" {
+		problems = append(problems, "signing key not defined")
+	}
+	if err := validationError("invalid signing options", problems); err != nil {
+		return err
+	}
+
+	key, err := LoadPrivateKey(s.Options.KeyPath)
+	if err != nil {
+		return errors.Wrap(err, "loading signing key")
+	}
+
+	images, err := s.images()
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		digests, err := s.releaseDigests(image)
+		if err != nil {
+			return errors.Wrapf(err, "resolving %s", image)
+		}
+		signed := map[string]bool{}
+		for _, ref := range digests {
+			if signed[ref] {
+				continue
+			}
+			logrus.Infof("🔏 Signing %s", ref)
+			if err := s.impl.SignImage(&s.Options, key, ref); err != nil {
+				return errors.Wrapf(err, "signing %s", ref)
+			}
+			signed[ref] = true
+		}
+	}
+	return nil
+}
+
+// Verify checks the signatures of every tag of the release images and
+// reports all the tags without a valid signature together
+func (s *Sign) Verify() error {
+	problems := s.Options.validate()
+	if s.Options.PublicKeyPath == "" {
+		problems = append(problems, "public key not defined")
+	}
+	if err := validationError("invalid verification options", problems); err != nil {
+		return err
+	}
+
+	key, err := LoadPublicKey(s.Options.PublicKeyPath)
+	if err != nil {
+		return errors.Wrap(err, "loading public key")
+	}
+
+	images, err := s.images()
+	if err != nil {
+		return err
+	}
+
+	problems = []string{}
+	for _, image := range images {
+		digests, err := s.releaseDigests(image)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", image, err))
+			continue
+		}
+		for _, tag := range sortedKeys(digests) {
+			ref := digests[tag]
+			if err := s.impl.VerifyImage(&s.Options, key, ref); err != nil {
+				problems = append(problems, fmt.Sprintf("%s:%s: %v", image, tag, err))
+				continue
+			}
+			logrus.Infof("✅ %s/%s:%s signature verified", s.Options.Registry, image, tag)
+		}
+	}
+	return validationError("signature verification failed", problems)
+}
+
+// images returns the images to process
+func (s *Sign) images() ([]string, error) {
+	if len(s.Options.Images) > 0 {
+		return s.Options.Images, nil
+	}
+	images, err := s.impl.DiscoverImages(&s.Options)
+	return images, errors.Wrap(err, "discovering images")
+}
+
+// releaseDigests returns the digest references of the version tags of
+// an image, indexed by tag
+func (s *Sign) releaseDigests(image string) (map[string]string, error) {
+	repo := fmt.Sprintf("%s/%s", s.Options.Registry, image)
+	tags, err := s.impl.ListTags(&s.Options, repo)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing tags")
+	}
+	digests := map[string]string{}
+	for _, tag := range tags {
+		if !isVersionTag(tag, s.Options.Version) {
+			continue
+		}
+		digest, err := s.impl.ResolveDigest(&s.Options, repo+":"+tag)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolving digest of %s", tag)
+		}
+		digests[tag] = repo + "@" + digest
+	}
+	if len(digests) == 0 {
+		return nil, errors.Errorf("no tags of version %s found in %s", s.Options.Version, repo)
+	}
+	return digests, nil
+}
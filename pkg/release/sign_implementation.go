@@ -0,0 +1,216 @@
+package release
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Signatures are stored in the cosign format so they can also be
+	// checked with `cosign verify --key`
+	signatureTagSuffix                     = "sig"
+	signatureAnnotation                    = "dev.cosignproject.cosign/signature"
+	simpleSigningType                      = "cosign container image signature"
+	simpleSigningMediaType types.MediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+)
+
+// simpleSigningPayload is the signed document, it binds the signature
+// to the image manifest digest
+type simpleSigningPayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]string `json:"optional"`
+}
+
+type defaultSignImplementation struct{}
+
+// DiscoverImages returns the images that are built from the repository
+func (di *defaultSignImplementation) DiscoverImages(o *SignOptions) ([]string, error) {
+	return (&defaultBuildImplementation{}).DiscoverImages(&BuildOptions{RepoPath: o.RepoPath})
+}
+
+// ListTags lists the tags of an image repository
+func (di *defaultSignImplementation) ListTags(o *SignOptions, repository string) ([]string, error) {
+	return listTags(repository)
+}
+
+// ResolveDigest returns the digest a reference points to
+func (di *defaultSignImplementation) ResolveDigest(o *SignOptions, refString string) (string, error) {
+	return resolveDigest(refString)
+}
+
+// SignImage signs an image digest and pushes the signature next to it
+func (di *defaultSignImplementation) SignImage(o *SignOptions, key crypto.Signer, refString string) error {
+	digest, err := name.NewDigest(refString)
+	if err != nil {
+		return errors.Wrap(err, "parsing digest reference")
+	}
+	payload, err := signingPayload(digest)
+	if err != nil {
+		return err
+	}
+	signature, err := signPayload(key, payload)
+	if err != nil {
+		return err
+	}
+	tag, err := attachedTag(digest, signatureTagSuffix)
+	if err != nil {
+		return errors.Wrap(err, "computing signature tag")
+	}
+	return attachLayer(
+		tag, static.NewLayer(payload, simpleSigningMediaType),
+		map[string]string{signatureAnnotation: signature}, nil,
+	)
+}
+
+// VerifyImage checks that an image digest has at least one signature
+// made with the key
+func (di *defaultSignImplementation) VerifyImage(o *SignOptions, key crypto.PublicKey, refString string) error {
+	digest, err := name.NewDigest(refString)
+	if err != nil {
+		return errors.Wrap(err, "parsing digest reference")
+	}
+	tag, err := attachedTag(digest, signatureTagSuffix)
+	if err != nil {
+		return errors.Wrap(err, "computing signature tag")
+	}
+	layers, err := attachedLayers(tag)
+	if err != nil {
+		return errors.Wrap(err, "reading signatures")
+	}
+	if len(layers) == 0 {
+		return errors.New("image is not signed")
+	}
+	for _, layer := range layers {
+		if layer.MediaType != simpleSigningMediaType {
+			continue
+		}
+		if err := verifyPayload(key, layer.Content, layer.Annotations[signatureAnnotation]); err != nil {
+			continue
+		}
+		payload := simpleSigningPayload{}
+		if err := json.Unmarshal(layer.Content, &payload); err != nil {
+			continue
+		}
+		if payload.Critical.Image.DockerManifestDigest == digest.DigestStr() {
+			return nil
+		}
+	}
+	return errors.New("no valid signature found for the key")
+}
+
+// signingPayload returns the simple signing document of an image digest
+func signingPayload(digest name.Digest) ([]byte, error) {
+	payload := simpleSigningPayload{}
+	payload.Critical.Identity.DockerReference = digest.Context().Name()
+	payload.Critical.Image.DockerManifestDigest = digest.DigestStr()
+	payload.Critical.Type = simpleSigningType
+	b, err := json.Marshal(payload)
+	return b, errors.Wrap(err, "marshaling signing payload")
+}
+
+// signPayload returns the base64 encoded signature of the payload
+func signPayload(key crypto.Signer, payload []byte) (string, error) {
+	sum := sha256.Sum256(payload)
+	signature, err := key.Sign(rand.Reader, sum[:], crypto.SHA256)
+	if err != nil {
+		return "", errors.Wrap(err, "signing payload")
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// verifyPayload checks a base64 encoded signature of the payload
+func verifyPayload(key crypto.PublicKey, payload []byte, signature string) error {
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.Errorf("unsupported public key type %T", key)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.Wrap(err, "decoding signature")
+	}
+	sum := sha256.Sum256(payload)
+	if !ecdsa.VerifyASN1(ecKey, sum[:], sig) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// LoadPrivateKey reads an unencrypted PEM encoded ECDSA private key, in
+// PKCS #8 or SEC 1 form, as generated by:
+//
+//	openssl ecparam -genkey -name prime256v1 | openssl pkcs8 -topk8 -nocrypt
+func LoadPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, errors.Errorf("unsupported private key type %q", block.Type)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing private key")
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("private key must be ECDSA, found %T", key)
+	}
+	return ecKey, nil
+}
+
+// LoadPublicKey reads a PEM encoded ECDSA public key
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, errors.Errorf("unsupported public key type %q", block.Type)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing public key")
+	}
+	if _, ok := key.(*ecdsa.PublicKey); !ok {
+		return nil, errors.Errorf("public key must be ECDSA, found %T", key)
+	}
+	return key, nil
+}
+
+// readPEM reads the first PEM block in a file
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", path)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.Errorf("no PEM data found in %s", path)
+	}
+	return block, nil
+}
@@ -0,0 +1,16 @@
+package release
+
+import "crypto"
+
+// mockSignImplementation reads the images from the registry but only
+// logs the signatures it would push
+type mockSignImplementation struct {
+	defaultSignImplementation
+	mockRecorder
+}
+
+// SignImage logs the image that would be signed
+func (mi *mockSignImplementation) SignImage(o *SignOptions, key crypto.Signer, ref string) error {
+	mi.record("sign %s", ref)
+	return nil
+}
@@ -0,0 +1,89 @@
+package release
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestKeyPair writes a PEM encoded key pair and returns their paths
+func newTestKeyPair(t *testing.T) (keyPath, pubPath string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	pubDer, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	keyPath = filepath.Join(dir, "vtrelease.key")
+	pubPath = filepath.Join(dir, "vtrelease.pub")
+	require.NoError(t, os.WriteFile(
+		keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), os.FileMode(0o600),
+	))
+	require.NoError(t, os.WriteFile(
+		pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer}), os.FileMode(0o644),
+	))
+	return keyPath, pubPath
+}
+
+func TestSignAndVerify(t *testing.T) {
+	reg := newTestRegistry(t) + "/vitess"
+	platform := v1.Platform{OS: "linux", Architecture: "amd64"}
+	idx := pushTestIndex(t, reg+"/vtgate:v12.0.4-buster", platform)
+	pushTestIndex(t, reg+"/vtgate:v12.0.4-bullseye", platform)
+	pushTestIndex(t, reg+"/vttablet:v12.0.4", platform)
+
+	keyPath, pubPath := newTestKeyPair(t)
+	opts := SignOptions{
+		Version:       "v12.0.4",
+		Registry:      reg,
+		Images:        []string{"vtgate"},
+		KeyPath:       keyPath,
+		PublicKeyPath: pubPath,
+	}
+
+	// Mock mode does not push signatures
+	require.NoError(t, NewSign(opts).Run())
+	require.Error(t, NewSign(opts).Verify())
+
+	opts.NoMock = true
+	require.NoError(t, NewSign(opts).Run())
+	require.NoError(t, NewSign(opts).Verify())
+
+	// Signing again replaces the signature of the same payload
+	require.NoError(t, NewSign(opts).Run())
+	require.NoError(t, NewSign(opts).Verify())
+	digest, err := idx.Digest()
+	require.NoError(t, err)
+	ref, err := name.NewDigest(reg + "/vtgate@" + digest.String())
+	require.NoError(t, err)
+	tag, err := attachedTag(ref, signatureTagSuffix)
+	require.NoError(t, err)
+	require.Equal(t, "sha256-"+digest.Hex+".sig", tag.TagStr())
+	layers, err := attachedLayers(tag)
+	require.NoError(t, err)
+	require.Len(t, layers, 1)
+
+	// Signatures do not verify with another key
+	_, otherPub := newTestKeyPair(t)
+	other := opts
+	other.PublicKeyPath = otherPub
+	require.Error(t, NewSign(other).Verify())
+
+	// Unsigned images fail verification
+	unsigned := opts
+	unsigned.Images = []string{"vtgate", "vttablet"}
+	err = NewSign(unsigned).Verify()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "vttablet:v12.0.4: image is not signed")
+}
@@ -2,9 +2,14 @@ package release
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/blang/semver"
 	"github.com/pkg/errors"
+	"github.com/puerco/vtrelease/pkg/env"
+	"github.com/sirupsen/logrus"
 	"sigs.k8s.io/release-sdk/git"
 )
 
@@ -13,13 +18,22 @@ type StageImplementation interface {
 	SetEnvironment(*StageOptions, *State) error
 	OpenRepository(*StageOptions, *State) error
 	GenerateReleaseNotes(*StageOptions, *State, string, string) error
+	ValidateReleaseNotes(*StageOptions, *State) error
 	WriteVersionFile(*StageOptions, string) error
 	GenerateJavaVersions(*StageOptions, *State, string) error
 	AddAndCommit(*StageOptions, *State, string) error
 	CreateTag(*StageOptions, *State, string, string) error
 	TagGoDocVersion(o *StageOptions, s *State) error
 	GetRevSHA(*StageOptions, *State, string) (string, error)
+	GetMergeBase(*StageOptions, *State, string, string) (string, error)
 	CheckEnvironment(*StageOptions) error
+	SaveState(*StageOptions, *State) error
+	LoadState(*StageOptions, *State) error
+	DeleteState(*StageOptions) error
+	DeleteTag(*StageOptions, *State, string) error
+	ResetBranch(*StageOptions, *State, string) error
+	RemoveUntrackedFile(*StageOptions, *State, string) (bool, error)
+	ListModifiedFiles(*StageOptions, *State) ([]string, error)
 }
 
 type StageOptions struct {
@@ -31,43 +45,157 @@ type StageOptions struct {
 
 	// GoDocVersion
 	GoDocVersion string
+
+	// ReleaseType selects how the version is computed: a release
+	// candidate, a GA promoting the last candidate or a patch release
+	ReleaseType string
+
+	// Version to release instead of computing it from the release
+	// type. It is validated against the branch and its tags.
+	Version string
+
+	// NoMock writes the release commits and tags to the repository. A
+	// mock stage logs them and saves its state as a rehearsal.
+	NoMock bool
+
+	// StateFile is the path where the stage state is persisted. When
+	// empty, it defaults to a file named after the branch in the temp dir.
+	StateFile string
+
+	// Resume reloads the state file and continues a failed run,
+	// skipping the steps that were already completed
+	Resume bool
+
+	// GitHubRepository is the owner/name of the repository where the
+	// pull requests in the release notes are looked up
+	GitHubRepository string
+
+	// NotesCache is a JSON file caching the pull requests listed in the
+	// release notes. Pull requests fetched from GitHub are added to it.
+	NotesCache string
+
+	// Offline generates the release notes only from the pull requests
+	// in the cache, without querying GitHub
+	Offline bool
+
+	// SummaryFile is the markdown summary placed at the top of the
+	// release notes. Defaults to doc/releasenotes/M_m_p_summary.md in
+	// the repository.
+	SummaryFile string
+
+	// PullRequestSource replaces the GitHub API and cache as the source
+	// of the pull requests listed in the release notes
+	PullRequestSource PullRequestSource
+}
+
+// StatePath returns the path to the file where the state is persisted
+func (o *StageOptions) StatePath() string {
+	return statePath(o.StateFile, o.Branch)
+}
+
+// statePath returns stateFile or, if empty, the default location of the
+// state file for branch
+func statePath(stateFile, branch string) string {
+	if stateFile != "" {
+		return stateFile
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("vtrelease-stage-%s.json", branch))
 }
 
+// Types of release that can be staged
+const (
+	ReleaseTypeRC    = "rc"
+	ReleaseTypeGA    = "ga"
+	ReleaseTypePatch = "patch"
+)
+
 func (o *StageOptions) Validate() error {
 	// TODO: Implement
 	if o.RepoPath == "" {
 		return errors.New("Path to repository not defined")
 	}
 
+	switch o.ReleaseType {
+	case ReleaseTypeRC, ReleaseTypeGA, ReleaseTypePatch, "":
+	default:
+		return errors.Errorf(
+			"invalid release type %q, must be one of %s, %s or %s",
+			o.ReleaseType, ReleaseTypeRC, ReleaseTypeGA, ReleaseTypePatch,
+		)
+	}
+
+	if o.Offline && o.NotesCache == "" && o.PullRequestSource == nil {
+		return errors.New("generating the release notes offline requires a pull request cache")
+	}
+
 	return nil
 }
 
+// Names of the steps recorded in the state as the stage progresses
+const (
+	stepPrepareEnvironment = "prepare-environment"
+	stepReleaseNotes       = "release-notes"
+	stepTagRepository      = "tag-repository"
+	stepCommitPrefix       = "commit:"
+	stepTagPrefix          = "tag:"
+	stepGoDocTagPrefix     = "godoc-tag:"
+)
+
 type State struct {
+	// Branch where the release is being cut
+	Branch string `json:"branch"`
+
 	// The tag we will cut
-	Version string
+	Version string `json:"version"`
 
 	// Version tag in semver
-	SemVer semver.Version
+	SemVer semver.Version `json:"semver"`
 
 	// Development version tag to follow the release we are cutting
-	DevVersion string
+	DevVersion string `json:"devVersion"`
 
 	// PreviousVersion cotains the last tag that was cut
-	PreviousVersion string
+	PreviousVersion string `json:"previousVersion"`
 
 	// GoDoc tag to apply to the release commit in addition to the release tag
-	GoDocVersion string
+	GoDocVersion string `json:"goDocVersion,omitempty"`
 
 	// Path to store the release notes file
-	ReleaseNotesPath string
+	ReleaseNotesPath string `json:"releaseNotesPath"`
 
 	// Current commit contains the last commit in the release before we add the release commit
-	CurrentCommit string
+	CurrentCommit string `json:"currentCommit"`
 
 	// SHA of the commit that will contain the tag
-	ReleasePoint string
+	ReleasePoint string `json:"releasePoint,omitempty"`
+
+	// NoMock records if the state was produced by a real run
+	NoMock bool `json:"noMock"`
 
-	Repository *git.Repo
+	// Steps lists the steps of the run completed so far
+	Steps []string `json:"steps"`
+
+	// Images lists the image variants pushed by the build and their digests
+	Images []ImageDigest `json:"images,omitempty"`
+
+	Repository *git.Repo `json:"-"`
+}
+
+// StepDone returns true if step was recorded as completed
+func (s *State) StepDone(step string) bool {
+	for _, done := range s.Steps {
+		if done == step {
+			return true
+		}
+	}
+	return false
+}
+
+// CompleteStep records step as completed
+func (s *State) CompleteStep(step string) {
+	if !s.StepDone(step) {
+		s.Steps = append(s.Steps, step)
+	}
 }
 
 type Stage struct {
@@ -77,28 +205,137 @@ type Stage struct {
 }
 
 func NewStage(o StageOptions) *Stage {
+	var impl StageImplementation = &mockStageImplementation{}
+	if o.NoMock {
+		impl = &DefaultStageImplementation{}
+	}
 	return &Stage{
-		impl:    &DefaultStageImplementation{},
+		impl:    impl,
 		Options: o,
 	}
 }
 
 // Run executes the release run
 func (s *Stage) Run() error {
-	if err := s.PrepareEnvironment(); err != nil {
-		return errors.Wrap(err, "setting up environment")
+	if err := s.initState(); err != nil {
+		return errors.Wrap(err, "initializing stage state")
 	}
 
-	if err := s.GenerateReleaseNotes(); err != nil {
-		return errors.Wrap(err, "generating release notes")
+	if !s.State.StepDone(stepPrepareEnvironment) {
+		if err := s.PrepareEnvironment(); err != nil {
+			return errors.Wrap(err, "setting up environment")
+		}
+		if err := s.completeStep(stepPrepareEnvironment); err != nil {
+			return err
+		}
 	}
 
-	if err := s.TagRepository(); err != nil {
-		return errors.Wrap(err, "tagging repo")
+	if !s.State.StepDone(stepReleaseNotes) {
+		if err := s.GenerateReleaseNotes(); err != nil {
+			return errors.Wrap(err, "generating release notes")
+		}
+		if err := s.completeStep(stepReleaseNotes); err != nil {
+			return err
+		}
+	}
+
+	if !s.State.StepDone(stepTagRepository) {
+		// The notes are checked on every run as they may have been
+		// fixed by hand before resuming
+		if err := s.impl.ValidateReleaseNotes(&s.Options, &s.State); err != nil {
+			return errors.Wrap(err, "validating release notes")
+		}
+		if err := s.TagRepository(); err != nil {
+			return errors.Wrap(err, "tagging repo")
+		}
+		if err := s.completeStep(stepTagRepository); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// Plan prepares the environment without modifying the repository and
+// returns what the stage will do
+func (s *Stage) Plan() (*Plan, error) {
+	s.State = State{Branch: s.Options.Branch, NoMock: s.Options.NoMock}
+	if err := s.PrepareEnvironment(); err != nil {
+		return nil, errors.Wrap(err, "setting up environment")
+	}
+
+	files, err := s.impl.ListModifiedFiles(&s.Options, &s.State)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing files to modify")
+	}
+
+	notesPath, err := filepath.Rel(s.Options.RepoPath, releaseNotesPath(&s.Options, &s.State))
+	if err != nil {
+		return nil, errors.Wrap(err, "getting release notes path")
+	}
+
+	plan := &Plan{
+		Branch:           s.State.Branch,
+		CurrentCommit:    s.State.CurrentCommit,
+		PreviousVersion:  s.State.PreviousVersion,
+		Version:          s.State.Version,
+		DevVersion:       s.State.DevVersion,
+		GoDocVersion:     s.State.GoDocVersion,
+		ReleaseNotesPath: notesPath,
+		Files:            files,
+		Commits:          []string{commitMessage(s.State.Version), commitMessage(s.State.DevVersion)},
+		Tags:             []string{s.State.Version},
+	}
+	if s.State.GoDocVersion != "" {
+		plan.Tags = append(plan.Tags, s.State.GoDocVersion)
+	}
+	return plan, nil
+}
+
+// initState starts a fresh state or, when resuming, reloads the
+// state of a previous run and reopens its repository
+func (s *Stage) initState() error {
+	if !s.Options.Resume {
+		// Refuse to clobber the state of an unfinished run
+		prev := State{}
+		if err := s.impl.LoadState(&s.Options, &prev); err == nil &&
+			prev.NoMock && !prev.StepDone(stepTagRepository) {
+			return errors.Errorf(
+				"state file %s contains an unfinished run, resume or roll it back first",
+				s.Options.StatePath(),
+			)
+		}
+		s.State = State{Branch: s.Options.Branch, NoMock: s.Options.NoMock}
+		return nil
+	}
+
+	if err := s.impl.LoadState(&s.Options, &s.State); err != nil {
+		return errors.Wrap(err, "loading state to resume")
+	}
+	if s.State.NoMock != s.Options.NoMock {
+		return errors.New("cannot resume a mock run for real or a real run in mock mode")
+	}
+	if s.Options.Branch == "" {
+		s.Options.Branch = s.State.Branch
+	}
+	if s.Options.Branch != s.State.Branch {
+		return errors.Errorf(
+			"state was recorded for branch %s, not %s", s.State.Branch, s.Options.Branch,
+		)
+	}
+	logrus.Infof("⏯️  Resuming staging of %s, completed steps: %v", s.State.Version, s.State.Steps)
+	return errors.Wrap(
+		s.impl.OpenRepository(&s.Options, &s.State), "reopening repository",
+	)
+}
+
+// completeStep records step as done and persists the state
+func (s *Stage) completeStep(step string) error {
+	s.State.CompleteStep(step)
+	return errors.Wrapf(
+		s.impl.SaveState(&s.Options, &s.State), "saving state after %s", step,
+	)
+}
+
 func (s *Stage) PrepareEnvironment() error {
 	// Verify the runner environment
 	if err := s.impl.CheckEnvironment(&s.Options); err != nil {
@@ -120,23 +357,28 @@ func (s *Stage) PrepareEnvironment() error {
 }
 
 func (s *Stage) GenerateReleaseNotes() error {
-	// Get the commit sha of the previous release
-	fromSha, err := s.impl.GetRevSHA(&s.Options, &s.State, s.State.PreviousVersion)
-	if err != nil {
-		return errors.Wrap(err, "getting previous release commit sha")
-	}
-
-	// Current commit is the tag commit. Therefore, we will generate the
-	// release notes up to the previous one
-	toSha, err := s.impl.GetRevSHA(
-		&s.Options, &s.State, fmt.Sprintf("%s~1", s.State.CurrentCommit),
-	)
-	if err != nil {
-		return errors.Wrap(err, "getting previous release commit sha")
+	// Get the commit sha of the previous release. The first release of
+	// a branch has no previous tag, its notes start where the branch
+	// was cut from main.
+	var fromSha string
+	var err error
+	if s.State.PreviousVersion == "" {
+		fromSha, err = s.impl.GetMergeBase(
+			&s.Options, &s.State, env.MainBranch, s.State.CurrentCommit,
+		)
+		if err != nil {
+			return errors.Wrap(err, "getting branch point commit sha")
+		}
+	} else {
+		fromSha, err = s.impl.GetRevSHA(&s.Options, &s.State, s.State.PreviousVersion)
+		if err != nil {
+			return errors.Wrap(err, "getting previous release commit sha")
+		}
 	}
 
-	// Run the release notes generator
-	return s.impl.GenerateReleaseNotes(&s.Options, &s.State, fromSha, toSha)
+	// Current commit is the last one before the release commit, the
+	// notes include everything up to it
+	return s.impl.GenerateReleaseNotes(&s.Options, &s.State, fromSha, s.State.CurrentCommit)
 }
 
 // TagRepository writes the version file and tag the repo. Each for the
@@ -144,16 +386,30 @@ func (s *Stage) GenerateReleaseNotes() error {
 func (s *Stage) TagRepository() error {
 	// We cycle here the two release versions
 	for _, tag := range []string{s.State.Version, s.State.DevVersion} {
-		if err := s.impl.GenerateJavaVersions(&s.Options, &s.State, tag); err != nil {
-			return errors.Wrapf(err, "generating version %s files in java source", s.State.Version)
-		}
-		// Write the version file
-		if err := s.impl.WriteVersionFile(&s.Options, tag); err != nil {
-			return errors.Wrapf(err, "writing tag %s to code", tag)
-		}
+		if !s.State.StepDone(stepCommitPrefix + tag) {
+			if err := s.impl.GenerateJavaVersions(&s.Options, &s.State, tag); err != nil {
+				return errors.Wrapf(err, "generating version %s files in java source", s.State.Version)
+			}
+			// Write the version file
+			if err := s.impl.WriteVersionFile(&s.Options, tag); err != nil {
+				return errors.Wrapf(err, "writing tag %s to code", tag)
+			}
+
+			if err := s.impl.AddAndCommit(&s.Options, &s.State, tag); err != nil {
+				return errors.Wrap(err, "creating tag commit")
+			}
 
-		if err := s.impl.AddAndCommit(&s.Options, &s.State, tag); err != nil {
-			return errors.Wrap(err, "creating tag commit")
+			// Record the commit that will get the release tag
+			if tag == s.State.Version {
+				releasePoint, err := s.impl.GetRevSHA(&s.Options, &s.State, "HEAD")
+				if err != nil {
+					return errors.Wrap(err, "getting release commit sha")
+				}
+				s.State.ReleasePoint = releasePoint
+			}
+			if err := s.completeStep(stepCommitPrefix + tag); err != nil {
+				return err
+			}
 		}
 
 		// When tagging the devversion, we do not tag
@@ -162,16 +418,108 @@ func (s *Stage) TagRepository() error {
 		}
 
 		// git tag -m Version\ $(RELEASE_VERSION) v$(RELEASE_VERSION)
-		if err := s.impl.CreateTag(&s.Options, &s.State, tag, fmt.Sprintf("Release commit for %s", tag)); err != nil {
-			return errors.Wrap(err, "creating tag")
+		if !s.State.StepDone(stepTagPrefix + tag) {
+			if err := s.impl.CreateTag(&s.Options, &s.State, tag, fmt.Sprintf("Release commit for %s", tag)); err != nil {
+				return errors.Wrap(err, "creating tag")
+			}
+			if err := s.completeStep(stepTagPrefix + tag); err != nil {
+				return err
+			}
 		}
 
 		// If we have a GO_DOC
-		if s.State.GoDocVersion != "" {
+		if s.State.GoDocVersion != "" && !s.State.StepDone(stepGoDocTagPrefix+s.State.GoDocVersion) {
 			if err := s.impl.TagGoDocVersion(&s.Options, &s.State); err != nil {
 				return errors.Wrap(err, "tagging godoc version")
 			}
+			if err := s.completeStep(stepGoDocTagPrefix + s.State.GoDocVersion); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
+
+// Rollback undoes a partially staged release recorded in the state file.
+// It deletes the tags created during the run, resets the branch to the
+// commit it was on before staging and removes the generated release
+// notes. It returns a list describing everything it undid.
+func (s *Stage) Rollback() (undone []string, err error) {
+	if err := s.impl.LoadState(&s.Options, &s.State); err != nil {
+		return nil, errors.Wrap(err, "loading state to roll back")
+	}
+	if s.Options.NoMock && !s.State.NoMock {
+		return nil, errors.New("state was recorded by a mock run, there is nothing to roll back")
+	}
+	if s.State.StepDone(stepPushBranch) {
+		return nil, errors.New("release was already pushed, it cannot be rolled back")
+	}
+	if s.State.CurrentCommit == "" {
+		return nil, errors.New("state does not record the commit the branch was on")
+	}
+	if s.Options.Branch == "" {
+		s.Options.Branch = s.State.Branch
+	}
+
+	if err := s.impl.OpenRepository(&s.Options, &s.State); err != nil {
+		return nil, errors.Wrap(err, "opening repository")
+	}
+
+	// Delete the tags in reverse order of creation
+	tags := []string{}
+	for i := len(s.State.Steps) - 1; i >= 0; i-- {
+		switch step := s.State.Steps[i]; {
+		case strings.HasPrefix(step, stepGoDocTagPrefix):
+			tags = append(tags, strings.TrimPrefix(step, stepGoDocTagPrefix))
+		case strings.HasPrefix(step, stepTagPrefix):
+			tags = append(tags, strings.TrimPrefix(step, stepTagPrefix))
+		}
+	}
+
+	// A run that failed before saving the state leaves tags that are not
+	// recorded as steps. They are deleted if they point to the release
+	// commit.
+	for _, tag := range []string{s.State.GoDocVersion, s.State.Version} {
+		if tag == "" || s.State.ReleasePoint == "" || stringInSlice(tag, tags) {
+			continue
+		}
+		commit, err := s.impl.GetRevSHA(&s.Options, &s.State, tag)
+		if err != nil || commit != s.State.ReleasePoint {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+
+	for _, tag := range tags {
+		if err := s.impl.DeleteTag(&s.Options, &s.State, tag); err != nil {
+			return undone, errors.Wrapf(err, "deleting tag %s", tag)
+		}
+		undone = append(undone, fmt.Sprintf("deleted tag %s", tag))
+	}
+
+	// Resetting drops the release commits and the changes to tracked files
+	if err := s.impl.ResetBranch(&s.Options, &s.State, s.State.CurrentCommit); err != nil {
+		return undone, errors.Wrap(err, "resetting branch")
+	}
+	undone = append(undone, fmt.Sprintf(
+		"reset branch %s to %s", s.State.Branch, s.State.CurrentCommit,
+	))
+
+	// If the release notes were not committed before, they are left
+	// behind as an untracked file
+	if s.State.ReleaseNotesPath != "" {
+		removed, err := s.impl.RemoveUntrackedFile(&s.Options, &s.State, s.State.ReleaseNotesPath)
+		if err != nil {
+			return undone, errors.Wrap(err, "removing release notes")
+		}
+		if removed {
+			undone = append(undone, fmt.Sprintf("removed release notes file %s", s.State.ReleaseNotesPath))
+		}
+	}
+
+	if err := s.impl.DeleteState(&s.Options); err != nil {
+		return undone, errors.Wrap(err, "deleting state file")
+	}
+	undone = append(undone, fmt.Sprintf("deleted state file %s", s.Options.StatePath()))
+	return undone, nil
+}
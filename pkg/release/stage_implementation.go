@@ -1,6 +1,7 @@
 package release
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -16,8 +17,6 @@ import (
 	"sigs.k8s.io/release-utils/util"
 )
 
-const versionFile = "go/vt/servenv/version.go"
-
 type DefaultStageImplementation struct{}
 
 func (di *DefaultStageImplementation) OpenRepository(o *StageOptions, s *State) error {
@@ -51,9 +50,20 @@ func (di *DefaultStageImplementation) SetEnvironment(o *StageOptions, s *State)
 	logrus.Infof("  > Previous release tag: %s", prevTag)
 	s.PreviousVersion = prevTag
 
-	nextTag, err := e.NextPatchVersion()
+	var nextTag string
+	switch {
+	case o.Version != "":
+		logrus.Infof("  > Using version %s set in the options", o.Version)
+		nextTag, err = e.ValidateVersion(o.Version)
+	case o.ReleaseType == ReleaseTypeRC:
+		nextTag, err = e.NextRCVersion()
+	case o.ReleaseType == ReleaseTypeGA:
+		nextTag, err = e.NextGAVersion()
+	default:
+		nextTag, err = e.NextPatchVersion()
+	}
 	if err != nil {
-		logrus.Fatal(errors.Wrap(err, "getting next tag in the branch"))
+		return errors.Wrap(err, "getting next tag in the branch")
 	}
 	sv, err := semver.Parse(strings.TrimPrefix(nextTag, "v"))
 	if err != nil {
@@ -63,9 +73,9 @@ func (di *DefaultStageImplementation) SetEnvironment(o *StageOptions, s *State)
 	s.Version = nextTag
 	s.SemVer = sv
 
-	devTag, err := e.NextDevVersion()
+	devTag, err := env.DevVersion(nextTag)
 	if err != nil {
-		logrus.Fatal(errors.Wrap(err, "getting next dev tag in the branch"))
+		return errors.Wrap(err, "getting next dev tag in the branch")
 	}
 	logrus.Infof("  > Next development tag will be: %s", devTag)
 	s.DevVersion = devTag
@@ -78,29 +88,77 @@ func (di *DefaultStageImplementation) SetEnvironment(o *StageOptions, s *State)
 	logrus.Infof("  > Current branch position: %s", curCommit)
 	s.CurrentCommit = curCommit
 
+	if o.GoDocVersion != "" {
+		logrus.Infof("  > GoDoc tag will be: %s", o.GoDocVersion)
+		s.GoDocVersion = o.GoDocVersion
+	}
+
 	return nil
 }
 
 // WriteVersionFile stamps the tag into the version.go file of the server
 func (di *DefaultStageImplementation) WriteVersionFile(o *StageOptions, tag string) error {
-	if tag == "" {
-		return errors.New("unable to write version files, empty tag")
+	return writeVersionFile(o.RepoPath, tag)
+}
+
+// releaseNotesPath returns the path of the release notes file. Pre-releases
+// get their own file, ie 13_0_0_rc1_release_notes.md, so they are not
+// overwritten by the next candidate or the GA.
+func releaseNotesPath(o *StageOptions, s *State) string {
+	name := fmt.Sprintf("%d_%d_%d", s.SemVer.Major, s.SemVer.Minor, s.SemVer.Patch)
+	for _, pre := range s.SemVer.Pre {
+		name += "_" + pre.String()
 	}
-	f, err := os.Create(filepath.Join(o.RepoPath, versionFile))
-	if err != nil {
-		return errors.Wrapf(err, "while opening %s for writing", versionFile)
+	return filepath.Join(o.RepoPath, "doc/releasenotes", name+"_release_notes.md")
+}
+
+// summaryPath returns the path of the release notes summary file
+func summaryPath(o *StageOptions, s *State) string {
+	if o.SummaryFile != "" {
+		return o.SummaryFile
 	}
-	defer f.Close()
+	return filepath.Join(
+		o.RepoPath, fmt.Sprintf(
+			"doc/releasenotes/%d_%d_%d_summary.md",
+			s.SemVer.Major, s.SemVer.Minor, s.SemVer.Patch,
+		),
+	)
+}
 
-	if _, err := fmt.Fprintf(
-		f, "package servenv\n\nconst versionName = \"%s\"\n", tag[1:],
-	); err != nil {
-		return errors.Wrap(err, "while writing tag to version file")
+// readSummary returns the summary of the release notes or an empty
+// string if the release does not have one. Patch releases can do without
+// a summary file, the rest of the releases must have one written by the
+// release team.
+func readSummary(o *StageOptions, s *State) (string, error) {
+	path := summaryPath(o, s)
+	if !util.Exists(path) {
+		if o.SummaryFile != "" || s.SemVer.Patch == 0 {
+			return "", errors.Errorf("release notes summary %s not found", path)
+		}
+		return "", nil
 	}
-	return nil
+	logrus.Infof("  > Using release notes summary from %s", path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "reading release notes summary")
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return "", errors.Errorf("release notes summary %s is empty", path)
+	}
+	return string(data), nil
 }
 
-// GenerateReleaseNotes runs the release not program to generate the changelog
+// patchSummary returns the standard summary of a patch release
+func patchSummary(s *State, notes *releaseNotes) string {
+	return fmt.Sprintf(
+		"## Summary\n\nThis is a patch release of the Vitess %d.%d release series. "+
+			"It includes %d pull requests merged since %s, listed in the changelog below.\n",
+		s.SemVer.Major, s.SemVer.Minor, len(notes.PullRequests), s.PreviousVersion,
+	)
+}
+
+// GenerateReleaseNotes writes the changelog of the pull requests merged
+// between shaFrom and shaEnd to the release notes file
 func (di *DefaultStageImplementation) GenerateReleaseNotes(
 	o *StageOptions, s *State, shaFrom, shaEnd string,
 ) error {
@@ -113,53 +171,78 @@ func (di *DefaultStageImplementation) GenerateReleaseNotes(
 	logrus.Infof("  > To SHA:   %s", shaEnd)
 
 	// Record the temporary file in the in the state
-	s.ReleaseNotesPath = filepath.Join(
-		o.RepoPath, fmt.Sprintf(
-			"doc/releasenotes/%d_%d_%d_release_notes.md",
-			s.SemVer.Major, s.SemVer.Minor, s.SemVer.Patch,
-		),
-	)
+	s.ReleaseNotesPath = releaseNotesPath(o, s)
 
-	// The release notes scipt b0rks if the file does not
-	// exist before running
-	if !util.Exists(s.ReleaseNotesPath) {
-		if err := os.WriteFile(s.ReleaseNotesPath, []byte{}, os.FileMode(0o644)); err != nil {
-			return errors.Wrap(err, "touching release notes file")
+	// Check the summary before looking up the pull requests
+	summary, err := readSummary(o, s)
+	if err != nil {
+		return errors.Wrap(err, "reading release notes summary")
+	}
+
+	source := o.PullRequestSource
+	if source == nil {
+		var upstream PullRequestSource
+		if !o.Offline {
+			repository := o.GitHubRepository
+			if repository == "" {
+				repository = DefaultGitHubRepository
+			}
+			upstream = newGitHubPullRequestSource(repository)
 		}
+		cache, err := loadPullRequestCache(o.NotesCache, upstream)
+		if err != nil {
+			return errors.Wrap(err, "loading pull request cache")
+		}
+		// Save what was fetched even if the notes fail
+		defer func() {
+			if err := cache.Save(); err != nil {
+				logrus.Warnf("Unable to save the pull request cache: %v", err)
+			}
+		}()
+		source = cache
 	}
 
-	// Run the release notes generator
-	cmd := command.NewWithWorkDir(
-		o.RepoPath, // CWD
-		"go",       // Path to compiled release notes binary
-		"run",
-		"./go/tools/release-notes",
-		"-from", shaFrom,
-		"-to", shaEnd,
-		"-version", s.Version,
-		// "-summary" TODO(puerco): Where to get the summary
-		"-file", s.ReleaseNotesPath,
+	notes, err := collectReleaseNotes(o.RepoPath, s.Version, shaFrom, shaEnd, source)
+	if err != nil {
+		return errors.Wrap(err, "collecting release notes")
+	}
+	logrus.Infof(
+		"  > %d pull requests in %d commits", len(notes.PullRequests), notes.Commits,
 	)
 
+	if summary == "" {
+		logrus.Info("  > No summary found, using the patch release summary")
+		summary = patchSummary(s, notes)
+	}
+	notes.Summary = summary
+
+	if err := os.MkdirAll(filepath.Dir(s.ReleaseNotesPath), os.FileMode(0o755)); err != nil {
+		return errors.Wrap(err, "creating release notes directory")
+	}
 	return errors.Wrap(
-		cmd.RunSuccess(), "calling release notes generator",
+		os.WriteFile(s.ReleaseNotesPath, []byte(notes.Markdown()), os.FileMode(0o644)),
+		"writing release notes",
 	)
 }
 
-// GenerateJavaVersions calls Maven to generate the needed files for this veersion
-func (di *DefaultStageImplementation) GenerateJavaVersions(o *StageOptions, s *State, tag string) error {
-	// Invoke maven to patch the sources
-	cmd := command.NewWithWorkDir(
-		filepath.Join(o.RepoPath, "java"),
-		"mvn", "versions:set", fmt.Sprintf("-DnewVersion=%s", tag),
-	)
-
-	// TODO(puerco): Ensure source has been patched correctly
+// ValidateReleaseNotes checks the release notes file is complete before
+// it is committed
+func (di *DefaultStageImplementation) ValidateReleaseNotes(o *StageOptions, s *State) error {
+	path := s.ReleaseNotesPath
+	if path == "" {
+		path = releaseNotesPath(o, s)
+	}
+	logrus.Infof("🔎 Validating release notes in %s", path)
+	if err := validationError("invalid release notes", validateReleaseNotes(path, s.Version)); err != nil {
+		return err
+	}
+	logrus.Info("✅ Release notes look good")
+	return nil
+}
 
-	// Execute the command
-	return errors.Wrapf(
-		cmd.RunSuccess(), "executing maven to patch sources with tag %s", tag,
-	)
+// GenerateJavaVersions sets the version of the java modules to the tag
+func (di *DefaultStageImplementation) GenerateJavaVersions(o *StageOptions, s *State, tag string) error {
+	return setJavaVersion(o.RepoPath, tag)
 }
 
 func (di *DefaultStageImplementation) TagGoDocVersion(o *StageOptions, s *State) error {
@@ -183,17 +266,20 @@ func (di *DefaultStageImplementation) AddAndCommit(o *StageOptions, s *State, ta
 	}
 
 	// git commit -n -s -m "Release commit for $(RELEASE_VERSION)"
-	commitMsg := fmt.Sprintf("Release commit for %s", tag)
-	if strings.HasSuffix(tag, "-SNAPSHOT") {
-		commitMsg = "Back to dev mode"
-	}
-
-	if err := s.Repository.UserCommit(commitMsg); err != nil {
+	if err := s.Repository.UserCommit(commitMessage(tag)); err != nil {
 		return errors.Wrap(err, "creating release commit")
 	}
 	return nil
 }
 
+// commitMessage returns the message of the commit stamping tag
+func commitMessage(tag string) string {
+	if strings.HasSuffix(tag, "-SNAPSHOT") {
+		return "Back to dev mode"
+	}
+	return fmt.Sprintf("Release commit for %s", tag)
+}
+
 // CreateTag tags the repository
 func (di *DefaultStageImplementation) CreateTag(
 	o *StageOptions, s *State, tag, message string,
@@ -223,11 +309,29 @@ func (di *DefaultStageImplementation) GetRevSHA(
 	return commit, err
 }
 
+// GetMergeBase returns the commit where revision forked from mainBranch.
+// The local branch is looked up first, then the one in the default remote.
+func (di *DefaultStageImplementation) GetMergeBase(
+	o *StageOptions, s *State, mainBranch, revision string,
+) (string, error) {
+	var lastErr error
+	for _, ref := range []string{mainBranch, git.Remotify(mainBranch)} {
+		output, err := command.NewWithWorkDir(
+			o.RepoPath, "git", "merge-base", ref, revision,
+		).RunSilentSuccessOutput()
+		if err == nil {
+			return output.OutputTrimNL(), nil
+		}
+		lastErr = err
+	}
+	return "", errors.Wrapf(lastErr, "finding merge base of %s and %s", mainBranch, revision)
+}
+
 // CheckEnvironment makes sure we are running in the environment we are supposed to
 func (di *DefaultStageImplementation) CheckEnvironment(o *StageOptions) error {
 	// Check that the executables we need are in the path
 	logrus.Info("🔎 Looking for executables required for the build")
-	for _, program := range []string{"release-notes", "mvn"} {
+	for _, program := range []string{"git"} {
 		path, err := exec.LookPath(program)
 		if err != nil {
 			return errors.Wrapf(err, "checking for %s in the system", program)
@@ -250,3 +354,115 @@ func (di *DefaultStageImplementation) CheckEnvironment(o *StageOptions) error {
 
 	return nil
 }
+
+// SaveState writes the state to the state file
+func (di *DefaultStageImplementation) SaveState(o *StageOptions, s *State) error {
+	return saveState(o.StatePath(), s)
+}
+
+// LoadState reads the state from the state file
+func (di *DefaultStageImplementation) LoadState(o *StageOptions, s *State) error {
+	return loadState(o.StatePath(), s)
+}
+
+// saveState writes the state as JSON to path
+func saveState(path string, s *State) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshaling state")
+	}
+	if err := os.WriteFile(path, data, os.FileMode(0o644)); err != nil {
+		return errors.Wrap(err, "writing state file")
+	}
+	logrus.Debugf("Saved release state to %s", path)
+	return nil
+}
+
+// loadState reads the JSON state in path
+func loadState(path string, s *State) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "reading state file")
+	}
+	return errors.Wrap(json.Unmarshal(data, s), "unmarshaling state")
+}
+
+// DeleteState removes the state file
+func (di *DefaultStageImplementation) DeleteState(o *StageOptions) error {
+	return errors.Wrap(os.Remove(o.StatePath()), "removing state file")
+}
+
+// DeleteTag removes a tag from the local repository
+func (di *DefaultStageImplementation) DeleteTag(o *StageOptions, s *State, tag string) error {
+	return errors.Wrapf(
+		command.NewWithWorkDir(o.RepoPath, "git", "tag", "-d", tag).RunSilentSuccess(),
+		"deleting tag %s", tag,
+	)
+}
+
+// ResetBranch checks out the release branch and hard resets it to commit
+func (di *DefaultStageImplementation) ResetBranch(o *StageOptions, s *State, commit string) error {
+	if err := s.Repository.Checkout(s.Branch); err != nil {
+		return errors.Wrapf(err, "checking out branch %s", s.Branch)
+	}
+	return errors.Wrapf(
+		command.NewWithWorkDir(o.RepoPath, "git", "reset", "--hard", commit).RunSilentSuccess(),
+		"resetting branch to %s", commit,
+	)
+}
+
+// RemoveUntrackedFile deletes path if it exists and is not tracked in
+// the repository. Returns true if the file was removed.
+func (di *DefaultStageImplementation) RemoveUntrackedFile(o *StageOptions, s *State, path string) (bool, error) {
+	if !util.Exists(path) {
+		return false, nil
+	}
+	// ls-files fails when the file is not tracked
+	if command.NewWithWorkDir(
+		o.RepoPath, "git", "ls-files", "--error-unmatch", path,
+	).RunSilentSuccess() == nil {
+		return false, nil
+	}
+	return true, errors.Wrapf(os.Remove(path), "removing %s", path)
+}
+
+// ListModifiedFiles returns the files the stage will modify, relative
+// to the repository root
+func (di *DefaultStageImplementation) ListModifiedFiles(o *StageOptions, s *State) ([]string, error) {
+	notes, err := filepath.Rel(o.RepoPath, releaseNotesPath(o, s))
+	if err != nil {
+		return nil, errors.Wrap(err, "getting release notes path")
+	}
+	poms, err := javaPomFiles(o.RepoPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing java modules")
+	}
+	return append([]string{versionFile, notes}, poms...), nil
+}
+
+// javaPomFiles returns the paths of all the pom.xml files in the java
+// directory, relative to the repository root
+func javaPomFiles(repoPath string) ([]string, error) {
+	poms := []string{}
+	err := filepath.Walk(filepath.Join(repoPath, "java"), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == "target" {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || info.Name() != "pom.xml" {
+			return nil
+		}
+		rel, err := filepath.Rel(repoPath, path)
+		if err != nil {
+			return err
+		}
+		poms = append(poms, rel)
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "walking java directory")
+	}
+	return poms, nil
+}
@@ -0,0 +1,121 @@
+package release
+
+import (
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/release-utils/util"
+)
+
+// mockStageImplementation uses the default stage implementation to read
+// from the repository but replaces every step that modifies it with a
+// no-op that logs and records what would have happened.
+type mockStageImplementation struct {
+	DefaultStageImplementation
+	mockRecorder
+}
+
+// WriteVersionFile logs the version that would be stamped in version.go
+func (mi *mockStageImplementation) WriteVersionFile(o *StageOptions, tag string) error {
+	if tag == "" {
+		return errors.New("unable to write version files, empty tag")
+	}
+	mi.record("write version %s to %s", tag, versionFile)
+	return nil
+}
+
+// GenerateReleaseNotes checks the summary and logs where the release
+// notes would be written without looking up the pull requests
+func (mi *mockStageImplementation) GenerateReleaseNotes(
+	o *StageOptions, s *State, shaFrom, shaEnd string,
+) error {
+	if shaFrom == shaEnd {
+		return errors.New("start and end commits for release notes are the same")
+	}
+	s.ReleaseNotesPath = releaseNotesPath(o, s)
+	if _, err := readSummary(o, s); err != nil {
+		return errors.Wrap(err, "reading release notes summary")
+	}
+	notes, err := filepath.Rel(o.RepoPath, s.ReleaseNotesPath)
+	if err != nil {
+		return errors.Wrap(err, "getting release notes path")
+	}
+	mi.record("write release notes for %s..%s to %s", shaFrom, shaEnd, notes)
+	return nil
+}
+
+// ValidateReleaseNotes checks the release notes if they exist, in mock
+// mode they are not written
+func (mi *mockStageImplementation) ValidateReleaseNotes(o *StageOptions, s *State) error {
+	path := s.ReleaseNotesPath
+	if path == "" {
+		path = releaseNotesPath(o, s)
+	}
+	if !util.Exists(path) {
+		logrus.Infof("  🧪 [mock] Release notes %s were not written, skipping validation", path)
+		return nil
+	}
+	return mi.DefaultStageImplementation.ValidateReleaseNotes(o, s)
+}
+
+// GenerateJavaVersions logs the version the java modules would be set to
+func (mi *mockStageImplementation) GenerateJavaVersions(o *StageOptions, s *State, tag string) error {
+	mi.record("set the java modules to version %s", javaVersion(tag))
+	return nil
+}
+
+// AddAndCommit logs the commit that would be created
+func (mi *mockStageImplementation) AddAndCommit(o *StageOptions, s *State, tag string) error {
+	mi.record("commit all changes with message %q", commitMessage(tag))
+	return nil
+}
+
+// CreateTag logs the tag that would be created
+func (mi *mockStageImplementation) CreateTag(o *StageOptions, s *State, tag, message string) error {
+	mi.record("create tag %s with message %q", tag, message)
+	return nil
+}
+
+// TagGoDocVersion logs the godoc tag that would be created
+func (mi *mockStageImplementation) TagGoDocVersion(o *StageOptions, s *State) error {
+	mi.record("create godoc tag %s", s.GoDocVersion)
+	return nil
+}
+
+// SaveState writes the state marked as a mock run, so the release and
+// the build can be rehearsed from it but refuse to run for real. The
+// state of a real run is never overwritten.
+func (mi *mockStageImplementation) SaveState(o *StageOptions, s *State) error {
+	prev := State{}
+	if err := loadState(o.StatePath(), &prev); err == nil && prev.NoMock {
+		return errors.Errorf("refusing to overwrite the state of a real run in %s", o.StatePath())
+	}
+	state := *s
+	state.NoMock = false
+	return mi.DefaultStageImplementation.SaveState(o, &state)
+}
+
+// DeleteState logs the removal of the state file
+func (mi *mockStageImplementation) DeleteState(o *StageOptions) error {
+	mi.record("delete state file %s", o.StatePath())
+	return nil
+}
+
+// DeleteTag logs the tag that would be deleted
+func (mi *mockStageImplementation) DeleteTag(o *StageOptions, s *State, tag string) error {
+	mi.record("delete tag %s", tag)
+	return nil
+}
+
+// ResetBranch logs the reset of the branch
+func (mi *mockStageImplementation) ResetBranch(o *StageOptions, s *State, commit string) error {
+	mi.record("hard reset branch %s to %s", s.Branch, commit)
+	return nil
+}
+
+// RemoveUntrackedFile logs the file that would be removed
+func (mi *mockStageImplementation) RemoveUntrackedFile(o *StageOptions, s *State, path string) (bool, error) {
+	mi.record("remove %s if untracked", path)
+	return false, nil
+}
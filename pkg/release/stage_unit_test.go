@@ -0,0 +1,270 @@
+package release
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/release-sdk/git"
+)
+
+// newTestRepo creates a git repository with a single commit in a
+// temporary directory
+func newTestRepo(t *testing.T) *git.Repo {
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--initial-branch=release-12.0")
+	runGit(t, dir, "config", "user.name", "Vitess Release Tester")
+	runGit(t, dir, "config", "user.email", "tester@example.com")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("# vitess\n"), os.FileMode(0o644)))
+	runGit(t, dir, "add", "README.md")
+	runGit(t, dir, "commit", "-m", "Initial commit")
+	repo, err := git.OpenRepo(dir)
+	require.NoError(t, err)
+	return repo
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+	return string(output)
+}
+
+// commitAndTag initializes a git repository in dir, commits all its
+// files as the release commit of version and tags it. Returns the sha
+// of the commit.
+func commitAndTag(t *testing.T, dir, version string) string {
+	runGit(t, dir, "init")
+	runGit(t, dir, "config", "user.name", "Vitess Release Tester")
+	runGit(t, dir, "config", "user.email", "tester@example.com")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-m", "Release commit for "+version)
+	runGit(t, dir, "tag", "-a", "-m", "Release "+version, version)
+	return strings.TrimSpace(runGit(t, dir, "rev-parse", "HEAD"))
+}
+
+func TestMockTagRepository(t *testing.T) {
+	mock := &mockStageImplementation{}
+	sut := &Stage{
+		impl:    mock,
+		Options: StageOptions{StateFile: filepath.Join(t.TempDir(), "state.json")},
+		State: State{
+			Version:      "v12.0.4",
+			DevVersion:   "v12.0.5-SNAPSHOT",
+			GoDocVersion: "v0.12.4",
+			Repository:   newTestRepo(t),
+		},
+	}
+	require.NoError(t, sut.TagRepository())
+	require.Equal(t, []string{
+		"set the java modules to version 12.0.4",
+		"write version v12.0.4 to " + versionFile,
+		`commit all changes with message "Release commit for v12.0.4"`,
+		`create tag v12.0.4 with message "Release commit for v12.0.4"`,
+		"create godoc tag v0.12.4",
+		"set the java modules to version 12.0.5-SNAPSHOT",
+		"write version v12.0.5-SNAPSHOT to " + versionFile,
+		`commit all changes with message "Back to dev mode"`,
+	}, mock.actions)
+	require.Equal(t, []string{
+		"commit:v12.0.4", "tag:v12.0.4", "godoc-tag:v0.12.4", "commit:v12.0.5-SNAPSHOT",
+	}, sut.State.Steps)
+}
+
+func TestResumeTagRepository(t *testing.T) {
+	mock := &mockStageImplementation{}
+	sut := &Stage{
+		impl:    mock,
+		Options: StageOptions{StateFile: filepath.Join(t.TempDir(), "state.json")},
+		State: State{
+			Version:    "v12.0.4",
+			DevVersion: "v12.0.5-SNAPSHOT",
+			Repository: newTestRepo(t),
+			Steps:      []string{"commit:v12.0.4"},
+		},
+	}
+	require.NoError(t, sut.TagRepository())
+	require.Equal(t, []string{
+		`create tag v12.0.4 with message "Release commit for v12.0.4"`,
+		"set the java modules to version 12.0.5-SNAPSHOT",
+		"write version v12.0.5-SNAPSHOT to " + versionFile,
+		`commit all changes with message "Back to dev mode"`,
+	}, mock.actions)
+}
+
+func TestStatePersistence(t *testing.T) {
+	opts := &StageOptions{StateFile: filepath.Join(t.TempDir(), "state.json")}
+	impl := &DefaultStageImplementation{}
+	state := &State{Branch: "release-12.0", Version: "v12.0.4", NoMock: true}
+	state.CompleteStep(stepPrepareEnvironment)
+	state.CompleteStep(stepPrepareEnvironment)
+	require.NoError(t, impl.SaveState(opts, state))
+
+	loaded := &State{}
+	require.NoError(t, impl.LoadState(opts, loaded))
+	require.Equal(t, "v12.0.4", loaded.Version)
+	require.True(t, loaded.NoMock)
+	require.True(t, loaded.StepDone(stepPrepareEnvironment))
+	require.False(t, loaded.StepDone(stepReleaseNotes))
+	require.Len(t, loaded.Steps, 1)
+}
+
+func TestMockGenerateReleaseNotes(t *testing.T) {
+	dir := newTestRepo(t).Dir()
+	mock := &mockStageImplementation{}
+	o := &StageOptions{RepoPath: dir}
+	s := &State{Version: "v12.0.4", PreviousVersion: "v12.0.3"}
+	s.SemVer.Major, s.SemVer.Minor, s.SemVer.Patch = 12, 0, 4
+
+	require.NoError(t, mock.GenerateReleaseNotes(o, s, "aaaa", "bbbb"))
+	require.Equal(t, []string{
+		"write release notes for aaaa..bbbb to doc/releasenotes/12_0_4_release_notes.md",
+	}, mock.actions)
+	require.NoFileExists(t, s.ReleaseNotesPath)
+	require.NoError(t, mock.ValidateReleaseNotes(o, s))
+
+	// The summary is still required for GA releases
+	ga := &State{Version: "v13.0.0"}
+	ga.SemVer.Major = 13
+	require.Error(t, mock.GenerateReleaseNotes(o, ga, "aaaa", "bbbb"))
+	require.Error(t, mock.GenerateReleaseNotes(o, s, "aaaa", "aaaa"))
+
+	// Notes that exist are validated
+	require.NoError(t, os.MkdirAll(filepath.Dir(s.ReleaseNotesPath), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(s.ReleaseNotesPath, []byte("\n"), os.FileMode(0o644)))
+	require.Error(t, mock.ValidateReleaseNotes(o, s))
+}
+
+func TestFirstReleaseCandidateNotes(t *testing.T) {
+	dir := newTestRepo(t).Dir()
+	branchPoint := strings.TrimSpace(runGit(t, dir, "rev-parse", "HEAD"))
+	runGit(t, dir, "branch", "main")
+	runGit(t, dir, "checkout", "-b", "release-13.0")
+	runGit(t, dir, "commit", "--allow-empty", "-m", "First change")
+	head := strings.TrimSpace(runGit(t, dir, "rev-parse", "HEAD"))
+	summary := filepath.Join(t.TempDir(), "summary.md")
+	require.NoError(t, os.WriteFile(summary, []byte("Summary\n"), os.FileMode(0o644)))
+
+	mock := &mockStageImplementation{}
+	sut := &Stage{
+		impl: mock,
+		Options: StageOptions{
+			RepoPath: dir, Branch: "release-13.0", ReleaseType: ReleaseTypeRC, SummaryFile: summary,
+		},
+	}
+	require.NoError(t, sut.PrepareEnvironment())
+	require.Equal(t, "v13.0.0-rc1", sut.State.Version)
+	require.Empty(t, sut.State.PreviousVersion)
+
+	// Without a previous tag, the notes start at the branch point
+	require.NoError(t, sut.GenerateReleaseNotes())
+	require.Equal(t, []string{
+		"write release notes for " + branchPoint + ".." + head + " to doc/releasenotes/13_0_0_rc1_release_notes.md",
+	}, mock.actions)
+}
+
+func TestMockSaveState(t *testing.T) {
+	mock := &mockStageImplementation{}
+	opts := &StageOptions{StateFile: filepath.Join(t.TempDir(), "state.json")}
+	state := &State{Branch: "release-12.0", Version: "v12.0.4", NoMock: true}
+	state.CompleteStep(stepTagRepository)
+
+	// Mock runs are recorded so they can be resumed and rehearsed
+	require.NoError(t, mock.SaveState(opts, state))
+	loaded := &State{}
+	require.NoError(t, mock.LoadState(opts, loaded))
+	require.False(t, loaded.NoMock)
+	require.True(t, loaded.StepDone(stepTagRepository))
+	require.True(t, state.NoMock)
+
+	// but do not replace the state of a real run
+	require.NoError(t, saveState(opts.StateFile, state))
+	require.Error(t, mock.SaveState(opts, state))
+}
+
+func TestRollback(t *testing.T) {
+	repo := newTestRepo(t)
+	dir := repo.Dir()
+	currentCommit := strings.TrimSpace(runGit(t, dir, "rev-parse", "HEAD"))
+
+	// Simulate a stage that failed after tagging
+	notesPath := filepath.Join(dir, "12_0_4_release_notes.md")
+	require.NoError(t, os.WriteFile(notesPath, []byte("# Release notes\n"), os.FileMode(0o644)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("v12.0.4\n"), os.FileMode(0o644)))
+	runGit(t, dir, "commit", "-am", "Release commit for v12.0.4")
+	runGit(t, dir, "tag", "-a", "-m", "Release commit for v12.0.4", "v12.0.4")
+	runGit(t, dir, "tag", "-a", "-m", "GoDoc", "v0.12.4")
+
+	opts := StageOptions{RepoPath: dir, StateFile: filepath.Join(t.TempDir(), "state.json"), NoMock: true}
+	require.NoError(t, saveState(opts.StateFile, &State{
+		Branch:           "release-12.0",
+		Version:          "v12.0.4",
+		GoDocVersion:     "v0.12.4",
+		CurrentCommit:    currentCommit,
+		ReleaseNotesPath: notesPath,
+		NoMock:           true,
+		Steps: []string{
+			stepPrepareEnvironment, stepReleaseNotes,
+			"commit:v12.0.4", "tag:v12.0.4", "godoc-tag:v0.12.4",
+		},
+	}))
+
+	sut := &Stage{Options: opts, impl: &DefaultStageImplementation{}}
+	undone, err := sut.Rollback()
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"deleted tag v0.12.4",
+		"deleted tag v12.0.4",
+		"reset branch release-12.0 to " + currentCommit,
+		"removed release notes file " + notesPath,
+		"deleted state file " + opts.StateFile,
+	}, undone)
+
+	require.Equal(t, currentCommit, strings.TrimSpace(runGit(t, dir, "rev-parse", "HEAD")))
+	require.Empty(t, strings.TrimSpace(runGit(t, dir, "tag")))
+	readme, err := os.ReadFile(filepath.Join(dir, "README.md"))
+	require.NoError(t, err)
+	require.Equal(t, "# vitess\n", string(readme))
+	require.NoFileExists(t, notesPath)
+	require.NoFileExists(t, opts.StateFile)
+}
+
+func TestRollbackUnrecordedTags(t *testing.T) {
+	repo := newTestRepo(t)
+	dir := repo.Dir()
+	currentCommit := strings.TrimSpace(runGit(t, dir, "rev-parse", "HEAD"))
+	runGit(t, dir, "tag", "-a", "-m", "GoDoc", "v0.12.4")
+
+	// The stage failed after tagging but before saving the state
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("v12.0.4\n"), os.FileMode(0o644)))
+	runGit(t, dir, "commit", "-am", "Release commit for v12.0.4")
+	runGit(t, dir, "tag", "-a", "-m", "Release commit for v12.0.4", "v12.0.4")
+	releasePoint := strings.TrimSpace(runGit(t, dir, "rev-parse", "HEAD"))
+
+	opts := StageOptions{RepoPath: dir, StateFile: filepath.Join(t.TempDir(), "state.json"), NoMock: true}
+	require.NoError(t, saveState(opts.StateFile, &State{
+		Branch:        "release-12.0",
+		Version:       "v12.0.4",
+		GoDocVersion:  "v0.12.4",
+		CurrentCommit: currentCommit,
+		ReleasePoint:  releasePoint,
+		NoMock:        true,
+		Steps:         []string{stepPrepareEnvironment, stepReleaseNotes, "commit:v12.0.4"},
+	}))
+
+	sut := &Stage{Options: opts, impl: &DefaultStageImplementation{}}
+	undone, err := sut.Rollback()
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"deleted tag v12.0.4",
+		"reset branch release-12.0 to " + currentCommit,
+		"deleted state file " + opts.StateFile,
+	}, undone)
+
+	// Tags on other commits are not touched
+	require.Equal(t, "v0.12.4", strings.TrimSpace(runGit(t, dir, "tag")))
+}
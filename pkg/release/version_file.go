@@ -0,0 +1,126 @@
+package release
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/pkg/errors"
+)
+
+const (
+	// versionFile is the file in the vitess repository holding the version
+	versionFile = "go/vt/servenv/version.go"
+
+	// versionConstant is the constant in versionFile set to the version
+	versionConstant = "versionName"
+)
+
+// versionLiteral parses the version file source and returns the string
+// literal assigned to the version constant
+func versionLiteral(fset *token.FileSet, src []byte) (*ast.BasicLit, error) {
+	f, err := parser.ParseFile(fset, versionFile, src, parser.ParseComments)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", versionFile)
+	}
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			value, ok := spec.(*ast.ValueSpec)
+			if !ok {
+				continue
+			}
+			for i, name := range value.Names {
+				if name.Name != versionConstant {
+					continue
+				}
+				if i >= len(value.Values) {
+					return nil, errors.Errorf("constant %s in %s has no value", versionConstant, versionFile)
+				}
+				lit, ok := value.Values[i].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					return nil, errors.Errorf("constant %s in %s is not a string literal", versionConstant, versionFile)
+				}
+				return lit, nil
+			}
+		}
+	}
+	return nil, errors.Errorf("constant %s not found in %s", versionConstant, versionFile)
+}
+
+// ReadVersionFile returns the version stamped in the version.go file
+// of the vitess repository in repoPath
+func ReadVersionFile(repoPath string) (string, error) {
+	src, err := os.ReadFile(filepath.Join(repoPath, versionFile))
+	if err != nil {
+		return "", errors.Wrap(err, "reading version file")
+	}
+	return readVersion(src)
+}
+
+// readVersion returns the value of the version constant in src
+func readVersion(src []byte) (string, error) {
+	lit, err := versionLiteral(token.NewFileSet(), src)
+	if err != nil {
+		return "", err
+	}
+	version, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return "", errors.Wrapf(err, "reading value of %s", versionConstant)
+	}
+	return version, nil
+}
+
+// writeVersionFile stamps the tag into the version constant of the
+// version.go file in repoPath. Only the constant value is replaced, the
+// rest of the file is kept as is.
+func writeVersionFile(repoPath, tag string) error {
+	if tag == "" {
+		return errors.New("unable to write version files, empty tag")
+	}
+	version := strings.TrimPrefix(tag, "v")
+	if _, err := semver.Parse(version); err != nil {
+		return errors.Wrapf(err, "invalid version tag %s", tag)
+	}
+
+	path := filepath.Join(repoPath, versionFile)
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrap(err, "checking version file")
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "reading version file")
+	}
+
+	fset := token.NewFileSet()
+	lit, err := versionLiteral(fset, src)
+	if err != nil {
+		return err
+	}
+	start, end := fset.Position(lit.Pos()).Offset, fset.Position(lit.End()).Offset
+	stamped := append([]byte{}, src[:start]...)
+	stamped = append(stamped, strconv.Quote(version)...)
+	stamped = append(stamped, src[end:]...)
+
+	// Make sure we are not writing a broken file
+	check, err := readVersion(stamped)
+	if err != nil {
+		return errors.Wrap(err, "checking stamped version file")
+	}
+	if check != version {
+		return errors.Errorf("stamped version file reads %q instead of %q", check, version)
+	}
+
+	return errors.Wrapf(
+		os.WriteFile(path, stamped, info.Mode()), "writing %s", versionFile,
+	)
+}
@@ -0,0 +1,83 @@
+package release
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testVersionFile = `/*
+Copyright 2022 The Vitess Authors.
+*/
+
+package servenv
+
+// This is where the version is stamped
+const (
+	versionName = "12.0.4-SNAPSHOT" // Set by the release tool
+	otherName   = "12.0.4-SNAPSHOT"
+)
+
+func version() string { return versionName }
+`
+
+// newTestVersionFile writes a version.go file with content in a
+// temporary repository
+func newTestVersionFile(t *testing.T, content string) string {
+	dir := t.TempDir()
+	path := filepath.Join(dir, versionFile)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(path, []byte(content), os.FileMode(0o644)))
+	return dir
+}
+
+func TestWriteVersionFile(t *testing.T) {
+	dir := newTestVersionFile(t, testVersionFile)
+	version, err := ReadVersionFile(dir)
+	require.NoError(t, err)
+	require.Equal(t, "12.0.4-SNAPSHOT", version)
+
+	// Only the version constant changes
+	for _, tag := range []string{"v12.0.4", "12.0.5-SNAPSHOT"} {
+		require.NoError(t, writeVersionFile(dir, tag))
+		data, err := os.ReadFile(filepath.Join(dir, versionFile))
+		require.NoError(t, err)
+		require.Equal(t, strings.Replace(
+			testVersionFile, `versionName = "12.0.4-SNAPSHOT"`,
+			`versionName = "`+strings.TrimPrefix(tag, "v")+`"`, 1,
+		), string(data))
+
+		version, err := ReadVersionFile(dir)
+		require.NoError(t, err)
+		require.Equal(t, strings.TrimPrefix(tag, "v"), version)
+	}
+
+	for _, tag := range []string{"", "vnext", "v12.0"} {
+		require.Error(t, writeVersionFile(dir, tag), tag)
+	}
+}
+
+func TestWriteVersionFileErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"missing constant": "package servenv\n\nconst otherName = \"12.0.4\"\n",
+		"not a literal":    "package servenv\n\nconst versionName = otherName\n",
+		"no value":         "package servenv\n\nconst (\n\totherName = \"12.0.4\"\n\tversionName\n)\n",
+		"broken file":      "package servenv\n\nconst versionName = \"12.0.4\n",
+	} {
+		dir := newTestVersionFile(t, content)
+		require.Error(t, writeVersionFile(dir, "v12.0.4"), name)
+		_, err := ReadVersionFile(dir)
+		require.Error(t, err, name)
+
+		// The file is left untouched
+		data, err := os.ReadFile(filepath.Join(dir, versionFile))
+		require.NoError(t, err)
+		require.Equal(t, content, string(data), name)
+	}
+
+	_, err := ReadVersionFile(t.TempDir())
+	require.Error(t, err)
+}